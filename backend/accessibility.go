@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Accessibility audit of a crawled page. Each rule that applies to the page
+// adds its severity's weight to the total, and the score is the share of
+// that weight whose rules passed.
+const maxAccessibilityFindings = 200 // findings kept per page
+
+var accessibilityWeights = map[string]int{
+	"error":   10,
+	"warning": 3,
+	"notice":  1,
+}
+
+// AccessibilityAudit holds the findings for one page of a crawl run
+type AccessibilityAudit struct {
+	ID        uint                   `json:"id" gorm:"primaryKey"`
+	URLID     uint                   `json:"url_id" gorm:"index"`
+	RunID     uint                   `json:"run_id" gorm:"index"`
+	PageURL   string                 `json:"page_url"`
+	Score     int                    `json:"score"` // 0-100
+	Findings  []AccessibilityFinding `json:"findings" gorm:"type:mediumtext;serializer:json"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type AccessibilityFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"` // error, warning, notice
+	Path     string `json:"path"`     // CSS-like path of the element
+	Message  string `json:"message"`
+}
+
+// accessibilityRules lists every rule with its severity
+var accessibilityRules = map[string]string{
+	"html-lang":           "error",
+	"image-alt":           "error",
+	"label":               "error",
+	"link-name":           "error",
+	"button-name":         "error",
+	"page-has-h1":         "warning",
+	"single-h1":           "warning",
+	"heading-order":       "warning",
+	"duplicate-id":        "warning",
+	"landmark-main":       "warning",
+	"landmark-navigation": "notice",
+}
+
+// accessibilityCheck walks a page and collects the rules it applied and failed
+type accessibilityCheck struct {
+	audit    *AccessibilityAudit
+	applied  map[string]bool
+	failed   map[string]bool
+	labelFor map[string]bool
+	ids      map[string]int
+
+	h1Count      int
+	lastHeading  int
+	mainCount    int
+	navLandmarks int
+}
+
+// run audits doc and sets the audit's findings and score
+func (audit *AccessibilityAudit) run(doc *html.Node) {
+	check := &accessibilityCheck{
+		audit:    audit,
+		applied:  make(map[string]bool),
+		failed:   make(map[string]bool),
+		labelFor: make(map[string]bool),
+		ids:      make(map[string]int),
+	}
+	audit.Findings = []AccessibilityFinding{}
+
+	// Labels may come after their controls, so collect them first
+	collectLabelTargets(doc, check.labelFor)
+	check.walk(doc)
+
+	check.applied["page-has-h1"] = true
+	if check.h1Count == 0 {
+		check.add("page-has-h1", "html", "Page has no h1 heading")
+	}
+	if check.h1Count > 0 {
+		check.applied["single-h1"] = true
+	}
+
+	check.applied["landmark-main"] = true
+	switch {
+	case check.mainCount == 0:
+		check.add("landmark-main", "html > body", "Page has no main landmark")
+	case check.mainCount > 1:
+		check.add("landmark-main", "html > body", "Page has more than one main landmark")
+	}
+	check.applied["landmark-navigation"] = true
+	if check.navLandmarks == 0 {
+		check.add("landmark-navigation", "html > body", "Page has no navigation landmark")
+	}
+
+	total, passed := 0, 0
+	for rule := range check.applied {
+		weight := accessibilityWeights[accessibilityRules[rule]]
+		total += weight
+		if !check.failed[rule] {
+			passed += weight
+		}
+	}
+	audit.Score = 100
+	if total > 0 {
+		audit.Score = passed * 100 / total
+	}
+}
+
+func (check *accessibilityCheck) add(rule, path, message string) {
+	check.applied[rule] = true
+	check.failed[rule] = true
+	if len(check.audit.Findings) >= maxAccessibilityFindings {
+		return
+	}
+	check.audit.Findings = append(check.audit.Findings, AccessibilityFinding{
+		Rule:     rule,
+		Severity: accessibilityRules[rule],
+		Path:     path,
+		Message:  message,
+	})
+}
+
+func (check *accessibilityCheck) walk(n *html.Node) {
+	if n.Type == html.ElementNode {
+		check.element(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		check.walk(c)
+	}
+}
+
+func (check *accessibilityCheck) element(n *html.Node) {
+	if id := strings.TrimSpace(attrValue(n, "id")); id != "" {
+		check.applied["duplicate-id"] = true
+		check.ids[id]++
+		if check.ids[id] == 2 {
+			check.add("duplicate-id", nodePath(n), fmt.Sprintf("ID %q is used more than once", id))
+		}
+	}
+
+	switch strings.ToLower(attrValue(n, "role")) {
+	case "main":
+		check.mainCount++
+	case "navigation":
+		check.navLandmarks++
+	}
+
+	switch n.Data {
+	case "html":
+		check.applied["html-lang"] = true
+		if strings.TrimSpace(attrValue(n, "lang")) == "" {
+			check.add("html-lang", nodePath(n), "The html element has no lang attribute")
+		}
+	case "main":
+		check.mainCount++
+	case "nav":
+		check.navLandmarks++
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(n.Data[1] - '0')
+		if level == 1 {
+			check.h1Count++
+			if check.h1Count == 2 {
+				check.add("single-h1", nodePath(n), "Page has more than one h1 heading")
+			}
+		}
+		if check.lastHeading > 0 {
+			check.applied["heading-order"] = true
+			if level > check.lastHeading+1 {
+				check.add("heading-order", nodePath(n), fmt.Sprintf("Heading level skips from h%d to h%d", check.lastHeading, level))
+			}
+		}
+		check.lastHeading = level
+	case "img":
+		check.applied["image-alt"] = true
+		if !hasAttr(n, "alt") && !isHidden(n) {
+			check.add("image-alt", nodePath(n), "Image has no alt text")
+		}
+	case "a":
+		if !hasAttr(n, "href") || isHidden(n) {
+			break
+		}
+		check.applied["link-name"] = true
+		if accessibleName(n) == "" {
+			check.add("link-name", nodePath(n), "Link has no accessible name")
+		}
+	case "button":
+		if isHidden(n) {
+			break
+		}
+		check.applied["button-name"] = true
+		if accessibleName(n) == "" {
+			check.add("button-name", nodePath(n), "Button has no accessible name")
+		}
+	case "input", "select", "textarea":
+		check.formControl(n)
+	}
+}
+
+func (check *accessibilityCheck) formControl(n *html.Node) {
+	if isHidden(n) {
+		return
+	}
+
+	inputType := strings.ToLower(attrValue(n, "type"))
+	if n.Data == "input" {
+		switch inputType {
+		case "hidden":
+			return
+		case "submit", "reset", "button":
+			// Buttons are named by their value, or a default label for submit and reset
+			check.applied["button-name"] = true
+			if inputType == "button" && strings.TrimSpace(attrValue(n, "value")) == "" && ariaLabel(n) == "" {
+				check.add("button-name", nodePath(n), "Button has no accessible name")
+			}
+			return
+		case "image":
+			check.applied["image-alt"] = true
+			if strings.TrimSpace(attrValue(n, "alt")) == "" && ariaLabel(n) == "" {
+				check.add("image-alt", nodePath(n), "Image button has no alt text")
+			}
+			return
+		}
+	}
+
+	check.applied["label"] = true
+	// The text of a select or textarea is its value, not a label
+	if check.labelFor[attrValue(n, "id")] || hasLabelAncestor(n) || ariaLabel(n) != "" {
+		return
+	}
+	check.add("label", nodePath(n), "Form control has no label")
+}
+
+// collectLabelTargets records the IDs referenced by <label for="...">
+func collectLabelTargets(n *html.Node, targets map[string]bool) {
+	if n.Type == html.ElementNode && n.Data == "label" {
+		if id := attrValue(n, "for"); id != "" {
+			targets[id] = true
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		collectLabelTargets(c, targets)
+	}
+}
+
+func hasLabelAncestor(n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.Data == "label" {
+			return true
+		}
+	}
+	return false
+}
+
+// accessibleName approximates the name assistive technology announces for
+// an element: ARIA labels, its title, its text or the alt text of images
+func accessibleName(n *html.Node) string {
+	if label := ariaLabel(n); label != "" {
+		return label
+	}
+
+	var parts []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			parts = append(parts, n.Data)
+		case n.Type == html.ElementNode && isHidden(n):
+			return
+		case n.Type == html.ElementNode && n.Data == "img":
+			parts = append(parts, attrValue(n, "alt"))
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c)
+	}
+
+	return strings.TrimSpace(strings.Join(parts, " "))
+}
+
+// ariaLabel returns the name an element is given by its attributes
+func ariaLabel(n *html.Node) string {
+	for _, key := range []string{"aria-label", "aria-labelledby", "title"} {
+		if value := strings.TrimSpace(attrValue(n, key)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func isHidden(n *html.Node) bool {
+	return hasAttr(n, "hidden") || strings.EqualFold(attrValue(n, "aria-hidden"), "true")
+}
+
+// nodePath describes an element like a CSS selector, such as
+// "html > body > nav#menu > ul > li:nth-of-type(2) > a"
+func nodePath(n *html.Node) string {
+	var parts []string
+	for ; n != nil && n.Type == html.ElementNode; n = n.Parent {
+		part := n.Data
+		if id := strings.TrimSpace(attrValue(n, "id")); id != "" && !strings.ContainsAny(id, " \t\n") {
+			part += "#" + id
+			parts = append(parts, part)
+			continue
+		}
+
+		position, count := 0, 0
+		if n.Parent != nil {
+			for s := n.Parent.FirstChild; s != nil; s = s.NextSibling {
+				if s.Type == html.ElementNode && s.Data == n.Data {
+					count++
+					if s == n {
+						position = count
+					}
+				}
+			}
+		}
+		if count > 1 {
+			part += fmt.Sprintf(":nth-of-type(%d)", position)
+		}
+		parts = append(parts, part)
+	}
+
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, " > ")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func auditHTML(t *testing.T, page string) *AccessibilityAudit {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit := &AccessibilityAudit{}
+	audit.run(doc)
+	return audit
+}
+
+func TestAccessibilityRules(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		rule string
+		fail bool
+		path string // path of the first finding, if checked
+	}{
+		{"image without alt", `<img src="a.png">`, "image-alt", true, "html > body > img"},
+		{"image with empty alt", `<img src="a.png" alt="">`, "image-alt", false, ""},
+		{"hidden image", `<img src="a.png" aria-hidden="true">`, "image-alt", false, ""},
+		{"image button without alt", `<input type="image" src="go.png">`, "image-alt", true, ""},
+		{"image button with alt", `<input type="image" src="go.png" alt="Go">`, "image-alt", false, ""},
+
+		{"skipped heading level", `<h1>A</h1><h3>B</h3>`, "heading-order", true, "html > body > h3"},
+		{"headings in order", `<h1>A</h1><h2>B</h2><h3>C</h3><h2>D</h2>`, "heading-order", false, ""},
+		{"heading back to h1", `<h1>A</h1><h2>B</h2><h3>C</h3><h1>D</h1>`, "heading-order", false, ""},
+
+		{"two h1", `<h1>A</h1><h1>B</h1>`, "single-h1", true, "html > body > h1:nth-of-type(2)"},
+		{"one h1", `<h1>A</h1><h2>B</h2>`, "single-h1", false, ""},
+		{"no h1", `<h2>A</h2>`, "page-has-h1", true, "html"},
+
+		{"input without label", `<input type="text" name="q">`, "label", true, "html > body > input"},
+		{"label for after the input", `<input id="q"><label for="q">Search</label>`, "label", false, ""},
+		{"wrapping label", `<label>Name <input name="name"></label>`, "label", false, ""},
+		{"aria-label", `<input aria-label="Search">`, "label", false, ""},
+		{"hidden input", `<input type="hidden" name="token">`, "label", false, ""},
+		{"select without label", `<select><option>A</option></select>`, "label", true, ""},
+		{"textarea with title", `<textarea title="Comment"></textarea>`, "label", false, ""},
+
+		{"empty link", `<a href="/"></a>`, "link-name", true, "html > body > a"},
+		{"link with text", `<a href="/">Home</a>`, "link-name", false, ""},
+		{"link named by image alt", `<a href="/"><img src="logo.png" alt="Home"></a>`, "link-name", false, ""},
+		{"link with only hidden text", `<a href="/"><span aria-hidden="true">→</span></a>`, "link-name", true, ""},
+		{"anchor without href", `<a name="top"></a>`, "link-name", false, ""},
+
+		{"empty button", `<button></button>`, "button-name", true, "html > body > button"},
+		{"button with text", `<button>Save</button>`, "button-name", false, ""},
+		{"input button without value", `<input type="button">`, "button-name", true, ""},
+		{"submit without value", `<input type="submit">`, "button-name", false, ""},
+
+		{"duplicate id", `<p id="a">1</p><p id="a">2</p>`, "duplicate-id", true, "html > body > p#a"},
+		{"unique ids", `<p id="a">1</p><p id="b">2</p>`, "duplicate-id", false, ""},
+
+		{"no main", `<div>Content</div>`, "landmark-main", true, "html > body"},
+		{"two mains", `<main>A</main><div role="main">B</div>`, "landmark-main", true, ""},
+		{"one main", `<main>A</main>`, "landmark-main", false, ""},
+		{"no navigation", `<main>A</main>`, "landmark-navigation", true, ""},
+		{"nav element", `<nav><a href="/">Home</a></nav>`, "landmark-navigation", false, ""},
+		{"navigation role", `<div role="navigation"></div>`, "landmark-navigation", false, ""},
+
+		{"html without lang", `<html><body></body></html>`, "html-lang", true, "html"},
+		{"html with empty lang", `<html lang=" "><body></body></html>`, "html-lang", true, ""},
+		{"html with lang", `<html lang="en"><body></body></html>`, "html-lang", false, ""},
+	}
+
+	for _, tt := range tests {
+		audit := auditHTML(t, tt.page)
+
+		var found []AccessibilityFinding
+		for _, finding := range audit.Findings {
+			if finding.Rule == tt.rule {
+				found = append(found, finding)
+			}
+		}
+
+		if tt.fail != (len(found) > 0) {
+			t.Errorf("%s: %s failed = %v, want %v (findings %+v)", tt.name, tt.rule, len(found) > 0, tt.fail, audit.Findings)
+			continue
+		}
+		if len(found) == 0 {
+			continue
+		}
+		if found[0].Severity != accessibilityRules[tt.rule] {
+			t.Errorf("%s: severity %q, want %q", tt.name, found[0].Severity, accessibilityRules[tt.rule])
+		}
+		if tt.path != "" && found[0].Path != tt.path {
+			t.Errorf("%s: path %q, want %q", tt.name, found[0].Path, tt.path)
+		}
+	}
+}
+
+func TestAccessibilityScore(t *testing.T) {
+	// Applies html-lang, link-name and image-alt (errors, 10 each), page-has-h1,
+	// single-h1 and landmark-main (warnings, 3 each) and landmark-navigation
+	// (notice, 1): 40 in total
+	const page = `<html lang="en"><body><nav><a href="/">Home</a></nav><main><h1>Title</h1><img src="a.png" alt="A"></main></body></html>`
+
+	tests := []struct {
+		name string
+		page string
+		want int
+	}{
+		{"all rules pass", page, 100},
+		{"error fails", strings.Replace(page, ` lang="en"`, "", 1), 75},                         // 30 of 40
+		{"warning fails", strings.Replace(page, "<h1>Title</h1>", "<h2>Title</h2>", 1), 91},     // 34 of 37; single-h1 no longer applies
+		{"notice fails", strings.Replace(page, "<nav><a href=\"/\">Home</a></nav>", "", 1), 96}, // 29 of 30; link-name no longer applies
+		{"failing twice counts once", strings.Replace(page, `alt="A">`, `><img src="b.png">`, 1), 75},
+		{"empty page", "", 0},
+	}
+
+	for _, tt := range tests {
+		if got := auditHTML(t, tt.page).Score; got != tt.want {
+			t.Errorf("%s: score %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAccessibilityFindingsCapped(t *testing.T) {
+	audit := auditHTML(t, strings.Repeat(`<img src="a.png">`, maxAccessibilityFindings+50))
+	if len(audit.Findings) != maxAccessibilityFindings {
+		t.Errorf("got %d findings, want %d", len(audit.Findings), maxAccessibilityFindings)
+	}
+}
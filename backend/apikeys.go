@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API keys for machine-to-machine access. A key acts as its owner, but only
+// on the routes opened by its scopes. Everything else needs a session.
+const (
+	apiKeyPrefix        = "wck_"
+	apiKeyTouchInterval = time.Minute // last_used_at is written at most this often
+)
+
+// Scopes and the role the owner needs to grant each one
+var apiKeyScopes = map[string]string{
+	"read":  roleViewer,
+	"crawl": roleOperator,
+}
+
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	Name       string     `json:"name" gorm:"size:100"`
+	Prefix     string     `json:"prefix" gorm:"size:16"` // start of the key, to tell keys apart
+	KeyHash    string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	Scopes     string     `json:"scopes"` // comma separated
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=read crawl"`
+}
+
+// CreateAPIKeyResponse is the only time the plain key is shown
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+// scopeRole returns the role needed to grant a set of scopes
+func scopeRole(scopes string) string {
+	role := ""
+	for _, scope := range strings.Split(scopes, ",") {
+		if granted := apiKeyScopes[scope]; roleRank[granted] > roleRank[role] {
+			role = granted
+		}
+	}
+	return role
+}
+
+// authenticateAPIKey resolves an API key to its owner
+func authenticateAPIKey(key string) (*User, *APIKey, error) {
+	if db == nil || !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, nil, errInvalidAPIKey
+	}
+
+	var apiKey APIKey
+	if err := db.Where("key_hash = ? AND revoked_at IS NULL", hashToken(key)).First(&apiKey).Error; err != nil {
+		return nil, nil, errInvalidAPIKey
+	}
+
+	var user User
+	if err := db.First(&user, apiKey.UserID).Error; err != nil {
+		return nil, nil, errInvalidAPIKey
+	}
+
+	// Avoid a write on every request from busy clients
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval {
+		db.Model(&apiKey).UpdateColumn("last_used_at", now)
+	}
+
+	return &user, &apiKey, nil
+}
+
+// requireSession rejects requests authenticated with an API key, for
+// routes that no scope opens
+func requireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("api_key_id") != 0 {
+			apiKeyForbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireScope only lets API keys through that carry the given scope.
+// Requests with a session are left to requireRole.
+func requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("api_key_id") != 0 && !containsString(strings.Split(c.GetString("api_key_scopes"), ","), scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":          "API key is missing the required scope",
+				"code":           "forbidden",
+				"required_scope": scope,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func apiKeyForbidden(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error": "Not available with an API key",
+		"code":  "forbidden",
+	})
+}
+
+// API Handlers
+func createAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	// A key can't be granted more than its owner may do
+	scopes := strings.Join(req.Scopes, ",")
+	if required := scopeRole(scopes); !hasRole(c, required) {
+		forbidden(c, required)
+		return
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	apiKey := APIKey{
+		UserID:  c.GetUint("user_id"),
+		Name:    req.Name,
+		Prefix:  key[:len(apiKeyPrefix)+6],
+		KeyHash: hashToken(key),
+		Scopes:  scopes,
+	}
+	if err := db.Create(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{APIKey: apiKey, Key: key})
+}
+
+func listAPIKeys(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	var keys []APIKey
+	if err := db.Where("user_id = ?", c.GetUint("user_id")).Order("id").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+func revokeAPIKey(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	var apiKey APIKey
+	if err := db.Where("id = ? AND user_id = ?", id, c.GetUint("user_id")).First(&apiKey).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	if apiKey.RevokedAt == nil {
+		now := time.Now()
+		if err := db.Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+		apiKey.RevokedAt = &now
+	}
+
+	c.JSON(http.StatusOK, apiKey)
+}
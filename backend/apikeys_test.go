@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		apiKey bool
+		scopes string
+		route  gin.HandlerFunc
+		want   int
+	}{
+		{"session skips scope check", false, "", requireScope("crawl"), http.StatusOK},
+		{"key with scope", true, "read,crawl", requireScope("crawl"), http.StatusOK},
+		{"key without scope", true, "read", requireScope("crawl"), http.StatusForbidden},
+		{"crawl scope does not imply read", true, "crawl", requireScope("read"), http.StatusForbidden},
+		{"scope names match exactly", true, "crawler", requireScope("crawl"), http.StatusForbidden},
+		{"session route with session", false, "", requireSession(), http.StatusOK},
+		{"session route with key", true, "read,crawl", requireSession(), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) {
+				if tt.apiKey {
+					c.Set("api_key_id", uint(1))
+					c.Set("api_key_scopes", tt.scopes)
+				}
+			}, tt.route, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
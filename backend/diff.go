@@ -0,0 +1,196 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Crawl run comparison
+type StringChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type BoolChange struct {
+	From bool `json:"from"`
+	To   bool `json:"to"`
+}
+
+type CountChange struct {
+	Field string `json:"field"`
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Delta int    `json:"delta"`
+}
+
+type CrawlRunDiff struct {
+	URLID   uint     `json:"url_id"`
+	FromRun CrawlRun `json:"from_run"`
+	ToRun   CrawlRun `json:"to_run"`
+	Changed bool     `json:"changed"`
+
+	Title        *StringChange `json:"title,omitempty"`
+	HTMLVersion  *StringChange `json:"html_version,omitempty"`
+	HasLoginForm *BoolChange   `json:"has_login_form,omitempty"`
+
+	// Only counts that changed are listed
+	Headings []CountChange `json:"headings"`
+	Counts   []CountChange `json:"counts"`
+
+	NewlyBroken []BrokenLink `json:"newly_broken"`
+	Fixed       []BrokenLink `json:"fixed"`
+	StillBroken int          `json:"still_broken"`
+}
+
+// diffRuns compares the stored analysis and broken links of two runs
+func diffRuns(from, to CrawlRun, fromLinks, toLinks []BrokenLink) CrawlRunDiff {
+	diff := CrawlRunDiff{
+		URLID:       to.URLID,
+		FromRun:     from,
+		ToRun:       to,
+		Headings:    []CountChange{},
+		Counts:      []CountChange{},
+		NewlyBroken: []BrokenLink{},
+		Fixed:       []BrokenLink{},
+	}
+
+	if from.Title != to.Title {
+		diff.Title = &StringChange{From: from.Title, To: to.Title}
+	}
+	if from.HTMLVersion != to.HTMLVersion {
+		diff.HTMLVersion = &StringChange{From: from.HTMLVersion, To: to.HTMLVersion}
+	}
+	if from.HasLoginForm != to.HasLoginForm {
+		diff.HasLoginForm = &BoolChange{From: from.HasLoginForm, To: to.HasLoginForm}
+	}
+
+	diff.Headings = countChanges([]CountChange{
+		{Field: "h1_count", From: from.H1Count, To: to.H1Count},
+		{Field: "h2_count", From: from.H2Count, To: to.H2Count},
+		{Field: "h3_count", From: from.H3Count, To: to.H3Count},
+		{Field: "h4_count", From: from.H4Count, To: to.H4Count},
+		{Field: "h5_count", From: from.H5Count, To: to.H5Count},
+		{Field: "h6_count", From: from.H6Count, To: to.H6Count},
+	})
+	diff.Counts = countChanges([]CountChange{
+		{Field: "internal_links", From: from.InternalLinks, To: to.InternalLinks},
+		{Field: "external_links", From: from.ExternalLinks, To: to.ExternalLinks},
+		{Field: "inaccessible_links", From: from.InaccessibleLinks, To: to.InaccessibleLinks},
+		{Field: "broken_images", From: from.BrokenImages, To: to.BrokenImages},
+		{Field: "broken_scripts", From: from.BrokenScripts, To: to.BrokenScripts},
+		{Field: "broken_stylesheets", From: from.BrokenStylesheets, To: to.BrokenStylesheets},
+		{Field: "broken_iframes", From: from.BrokenIframes, To: to.BrokenIframes},
+		{Field: "broken_media", From: from.BrokenMedia, To: to.BrokenMedia},
+		{Field: "pages_crawled", From: from.PagesCrawled, To: to.PagesCrawled},
+	})
+
+	// A link is identified by its target and resource type; the page it
+	// was found on may differ between site crawls
+	key := func(link BrokenLink) string {
+		return link.ResourceType + " " + link.LinkURL
+	}
+
+	fromSet := make(map[string]bool)
+	for _, link := range fromLinks {
+		fromSet[key(link)] = true
+	}
+	toSet := make(map[string]bool)
+	for _, link := range toLinks {
+		k := key(link)
+		if toSet[k] {
+			continue
+		}
+		toSet[k] = true
+
+		if fromSet[k] {
+			diff.StillBroken++
+		} else {
+			diff.NewlyBroken = append(diff.NewlyBroken, link)
+		}
+	}
+	for _, link := range fromLinks {
+		k := key(link)
+		if !toSet[k] {
+			diff.Fixed = append(diff.Fixed, link)
+			toSet[k] = true // report each fixed link once
+		}
+	}
+
+	diff.Changed = diff.Title != nil || diff.HTMLVersion != nil || diff.HasLoginForm != nil ||
+		len(diff.Headings) > 0 || len(diff.Counts) > 0 || len(diff.NewlyBroken) > 0 || len(diff.Fixed) > 0
+
+	return diff
+}
+
+// countChanges keeps the entries whose value changed and fills in the delta
+func countChanges(changes []CountChange) []CountChange {
+	changed := []CountChange{}
+	for _, change := range changes {
+		if change.From != change.To {
+			change.Delta = change.To - change.From
+			changed = append(changed, change)
+		}
+	}
+	return changed
+}
+
+// API Handlers
+func getURLDiff(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID"})
+		return
+	}
+
+	var urlRecord URL
+	if err := ownedURLs(c).First(&urlRecord, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	// "to" defaults to the latest run and "from" to the run before it
+	var to CrawlRun
+	query := db.Where("url_id = ?", urlRecord.ID)
+	if toParam := c.Query("to"); toParam != "" {
+		toID, err := strconv.Atoi(toParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' run ID"})
+			return
+		}
+		query = query.Where("id = ?", toID)
+	}
+	if err := query.Order("id desc").First(&to).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Crawl run not found"})
+		return
+	}
+
+	var from CrawlRun
+	query = db.Where("url_id = ?", urlRecord.ID)
+	if fromParam := c.Query("from"); fromParam != "" {
+		fromID, err := strconv.Atoi(fromParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' run ID"})
+			return
+		}
+		query = query.Where("id = ?", fromID)
+	} else {
+		query = query.Where("id < ?", to.ID)
+	}
+	if err := query.Order("id desc").First(&from).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No earlier crawl run to compare with"})
+		return
+	}
+
+	var fromLinks, toLinks []BrokenLink
+	db.Where("url_id = ? AND run_id = ?", urlRecord.ID, from.ID).Order("id").Find(&fromLinks)
+	db.Where("url_id = ? AND run_id = ?", urlRecord.ID, to.ID).Order("id").Find(&toLinks)
+
+	c.JSON(http.StatusOK, diffRuns(from, to, fromLinks, toLinks))
+}
@@ -0,0 +1,114 @@
+package main
+
+import "testing"
+
+func TestDiffRuns(t *testing.T) {
+	from := CrawlRun{
+		ID:           1,
+		URLID:        7,
+		PagesCrawled: 1,
+		PageAnalysis: PageAnalysis{
+			Title:             "Old title",
+			HTMLVersion:       "HTML5",
+			H1Count:           1,
+			H2Count:           3,
+			InternalLinks:     10,
+			ExternalLinks:     2,
+			InaccessibleLinks: 2,
+			BrokenImages:      1,
+		},
+	}
+	to := CrawlRun{
+		ID:           2,
+		URLID:        7,
+		PagesCrawled: 1,
+		PageAnalysis: PageAnalysis{
+			Title:             "New title",
+			HTMLVersion:       "HTML5",
+			H1Count:           1,
+			H2Count:           5,
+			InternalLinks:     10,
+			ExternalLinks:     2,
+			InaccessibleLinks: 2,
+			HasLoginForm:      true,
+		},
+	}
+
+	fromLinks := []BrokenLink{
+		{ID: 1, RunID: 1, LinkURL: "https://example.com/gone", ResourceType: "link", StatusCode: 404},
+		{ID: 2, RunID: 1, LinkURL: "https://example.com/fixed", ResourceType: "link", StatusCode: 500},
+		{ID: 3, RunID: 1, LinkURL: "https://example.com/logo.png", ResourceType: "image", StatusCode: 404},
+	}
+	toLinks := []BrokenLink{
+		{ID: 4, RunID: 2, LinkURL: "https://example.com/gone", ResourceType: "link", StatusCode: 404},
+		{ID: 5, RunID: 2, LinkURL: "https://example.com/new", ResourceType: "link", StatusCode: 404},
+		// Found on a second page - still one broken link
+		{ID: 6, RunID: 2, PageURL: "https://example.com/other", LinkURL: "https://example.com/new", ResourceType: "link", StatusCode: 404},
+		// Same target, different resource type
+		{ID: 7, RunID: 2, LinkURL: "https://example.com/fixed", ResourceType: "image", StatusCode: 404},
+	}
+
+	diff := diffRuns(from, to, fromLinks, toLinks)
+
+	if !diff.Changed {
+		t.Error("Changed = false, want true")
+	}
+	if diff.URLID != 7 || diff.FromRun.ID != 1 || diff.ToRun.ID != 2 {
+		t.Errorf("runs = %d..%d of URL %d, want 1..2 of URL 7", diff.FromRun.ID, diff.ToRun.ID, diff.URLID)
+	}
+
+	if diff.Title == nil || diff.Title.From != "Old title" || diff.Title.To != "New title" {
+		t.Errorf("Title = %+v, want Old title -> New title", diff.Title)
+	}
+	if diff.HTMLVersion != nil {
+		t.Errorf("HTMLVersion = %+v, want unchanged", diff.HTMLVersion)
+	}
+	if diff.HasLoginForm == nil || diff.HasLoginForm.From || !diff.HasLoginForm.To {
+		t.Errorf("HasLoginForm = %+v, want false -> true", diff.HasLoginForm)
+	}
+
+	if len(diff.Headings) != 1 || diff.Headings[0] != (CountChange{Field: "h2_count", From: 3, To: 5, Delta: 2}) {
+		t.Errorf("Headings = %+v, want only h2_count 3 -> 5", diff.Headings)
+	}
+	if len(diff.Counts) != 1 || diff.Counts[0] != (CountChange{Field: "broken_images", From: 1, To: 0, Delta: -1}) {
+		t.Errorf("Counts = %+v, want only broken_images 1 -> 0", diff.Counts)
+	}
+
+	assertLinks(t, "NewlyBroken", diff.NewlyBroken, []uint{5, 7})
+	assertLinks(t, "Fixed", diff.Fixed, []uint{2, 3})
+	if diff.StillBroken != 1 {
+		t.Errorf("StillBroken = %d, want 1", diff.StillBroken)
+	}
+}
+
+func TestDiffRunsUnchanged(t *testing.T) {
+	run := CrawlRun{ID: 1, PageAnalysis: PageAnalysis{Title: "Same", H1Count: 1}}
+	links := []BrokenLink{{LinkURL: "https://example.com/a", ResourceType: "link"}}
+
+	next := run
+	next.ID = 2
+	diff := diffRuns(run, next, links, links)
+
+	if diff.Changed {
+		t.Errorf("Changed = true for identical runs: %+v", diff)
+	}
+	if diff.Headings == nil || diff.Counts == nil || diff.NewlyBroken == nil || diff.Fixed == nil {
+		t.Error("empty lists should be [] rather than null in JSON")
+	}
+	if diff.StillBroken != 1 {
+		t.Errorf("StillBroken = %d, want 1", diff.StillBroken)
+	}
+}
+
+func assertLinks(t *testing.T, name string, got []BrokenLink, wantIDs []uint) {
+	t.Helper()
+	if len(got) != len(wantIDs) {
+		t.Errorf("%s has %d links, want %d", name, len(got), len(wantIDs))
+		return
+	}
+	for i, link := range got {
+		if link.ID != wantIDs[i] {
+			t.Errorf("%s[%d] = link %d, want link %d", name, i, link.ID, wantIDs[i])
+		}
+	}
+}
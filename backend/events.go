@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Live crawl events. The crawler publishes to an in-process bus and each
+// /api/events stream subscribes to it. Events only reach streams served by
+// the replica running the crawl.
+const (
+	eventBufferSize       = 64
+	progressEventInterval = 500 * time.Millisecond
+	eventHeartbeat        = 15 * time.Second
+)
+
+type CrawlEvent struct {
+	Type   string    `json:"type"` // status, progress, summary
+	URLID  uint      `json:"url_id"`
+	RunID  uint      `json:"run_id,omitempty"`
+	Status string    `json:"status,omitempty"`
+	Time   time.Time `json:"time"`
+
+	// Progress of a running crawl
+	LinksChecked int64 `json:"links_checked,omitempty"`
+	LinksTotal   int64 `json:"links_total,omitempty"`
+	PagesVisited int64 `json:"pages_visited,omitempty"`
+
+	// Final results, sent with the summary event
+	Analysis     *PageAnalysis `json:"analysis,omitempty"`
+	PagesCrawled int           `json:"pages_crawled,omitempty"`
+	ErrorMessage string        `json:"error_message,omitempty"`
+
+	// Who may see the event
+	userID    uint
+	projectID *uint
+}
+
+type eventSubscriber struct {
+	userID   uint
+	projects map[uint]bool // projects of the user's organisations, refreshed on each heartbeat
+	urlID    uint          // only events of this URL, 0 for all
+	events   chan CrawlEvent
+}
+
+// streamAccess is how an event stream was authenticated. It is checked
+// again on every heartbeat so streams end when their access does.
+type streamAccess struct {
+	userID    uint
+	sessionID uint
+	apiKeyID  uint
+}
+
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+}
+
+var events = &eventBus{subscribers: make(map[*eventSubscriber]struct{})}
+
+func (b *eventBus) subscribe(sub *eventSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[sub] = struct{}{}
+}
+
+func (b *eventBus) unsubscribe(sub *eventSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, sub)
+}
+
+// setProjects replaces the projects whose events a subscriber receives
+func (b *eventBus) setProjects(sub *eventSubscriber, projects map[uint]bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub.projects = projects
+}
+
+// publish delivers an event to every subscriber allowed to see it. Slow
+// subscribers miss events rather than holding up the crawler.
+func (b *eventBus) publish(event CrawlEvent) {
+	event.Time = time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		if !sub.wants(&event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
+
+func (s *eventSubscriber) wants(event *CrawlEvent) bool {
+	if s.urlID != 0 && s.urlID != event.URLID {
+		return false
+	}
+	return event.userID == s.userID || (event.projectID != nil && s.projects[*event.projectID])
+}
+
+// publishStatus announces a URL's current status
+func publishStatus(urlRecord *URL) {
+	event := CrawlEvent{
+		Type:         "status",
+		URLID:        urlRecord.ID,
+		Status:       urlRecord.Status,
+		ErrorMessage: urlRecord.ErrorMessage,
+		userID:       urlRecord.UserID,
+		projectID:    urlRecord.ProjectID,
+	}
+	if urlRecord.LatestRunID != nil {
+		event.RunID = *urlRecord.LatestRunID
+	}
+	events.publish(event)
+}
+
+// publishStatusOf announces the status of URLs changed by a bulk update
+func publishStatusOf(urlIDs []uint) {
+	if len(urlIDs) == 0 {
+		return
+	}
+
+	var urls []URL
+	db.Select("id", "user_id", "project_id", "status", "latest_run_id", "error_message").
+		Where("id IN ?", urlIDs).Find(&urls)
+	for i := range urls {
+		publishStatus(&urls[i])
+	}
+}
+
+// publishSummary announces the results of a finished run
+func publishSummary(urlRecord *URL, run *CrawlRun) {
+	analysis := run.PageAnalysis
+	events.publish(CrawlEvent{
+		Type:         "summary",
+		URLID:        urlRecord.ID,
+		RunID:        run.ID,
+		Status:       run.Status,
+		Analysis:     &analysis,
+		PagesCrawled: run.PagesCrawled,
+		ErrorMessage: run.ErrorMessage,
+		userID:       urlRecord.UserID,
+		projectID:    urlRecord.ProjectID,
+	})
+}
+
+// crawlProgress counts the work done by a running crawl and publishes it
+// at most every progressEventInterval. A nil *crawlProgress ignores updates.
+type crawlProgress struct {
+	urlRecord *URL
+	runID     uint
+
+	linksChecked atomic.Int64
+	linksTotal   atomic.Int64
+	pagesVisited atomic.Int64
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func newCrawlProgress(urlRecord *URL, run *CrawlRun) *crawlProgress {
+	return &crawlProgress{urlRecord: urlRecord, runID: run.ID}
+}
+
+func (p *crawlProgress) linksFound(n int) {
+	if p == nil {
+		return
+	}
+	p.linksTotal.Add(int64(n))
+	p.publish(false)
+}
+
+func (p *crawlProgress) linkChecked() {
+	if p == nil {
+		return
+	}
+	p.linksChecked.Add(1)
+	p.publish(false)
+}
+
+func (p *crawlProgress) pageVisited() {
+	if p == nil {
+		return
+	}
+	p.pagesVisited.Add(1)
+	p.publish(true)
+}
+
+func (p *crawlProgress) publish(force bool) {
+	p.mu.Lock()
+	if !force && time.Since(p.last) < progressEventInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.last = time.Now()
+	p.mu.Unlock()
+
+	events.publish(CrawlEvent{
+		Type:         "progress",
+		URLID:        p.urlRecord.ID,
+		RunID:        p.runID,
+		Status:       "running",
+		LinksChecked: p.linksChecked.Load(),
+		LinksTotal:   p.linksTotal.Load(),
+		PagesVisited: p.pagesVisited.Load(),
+		userID:       p.urlRecord.UserID,
+		projectID:    p.urlRecord.ProjectID,
+	})
+}
+
+// check reports whether the user, and the session or API key the stream
+// was opened with, are still valid, and returns the projects they may see
+func (a streamAccess) check() (map[uint]bool, bool) {
+	var user User
+	if err := db.Select("id").First(&user, a.userID).Error; err != nil {
+		return nil, false
+	}
+	if a.sessionID != 0 && !sessionActive(a.sessionID) {
+		return nil, false
+	}
+	if a.apiKeyID != 0 {
+		var count int64
+		db.Model(&APIKey{}).Where("id = ? AND revoked_at IS NULL", a.apiKeyID).Count(&count)
+		if count == 0 {
+			return nil, false
+		}
+	}
+
+	var projectIDs []uint
+	if err := db.Model(&Project{}).Where("organization_id IN (?)", memberOrganizationIDs(a.userID)).Pluck("id", &projectIDs).Error; err != nil {
+		return nil, false
+	}
+	projects := make(map[uint]bool, len(projectIDs))
+	for _, id := range projectIDs {
+		projects[id] = true
+	}
+	return projects, true
+}
+
+// API Handlers
+func streamEvents(c *gin.Context) {
+	access := streamAccess{
+		userID:    c.GetUint("user_id"),
+		sessionID: c.GetUint("session_id"),
+		apiKeyID:  c.GetUint("api_key_id"),
+	}
+	sub := &eventSubscriber{
+		userID:   access.userID,
+		projects: make(map[uint]bool),
+		events:   make(chan CrawlEvent, eventBufferSize),
+	}
+
+	if urlID := c.Query("url_id"); urlID != "" {
+		id, err := strconv.Atoi(urlID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID"})
+			return
+		}
+		sub.urlID = uint(id)
+	}
+
+	if db != nil {
+		if projects, ok := access.check(); ok {
+			sub.projects = projects
+		}
+	}
+
+	events.subscribe(sub)
+	defer events.unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // don't let nginx buffer the stream
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			// End the stream once its session, key or user is gone, and
+			// follow changes to the user's organisations
+			if db != nil {
+				projects, ok := access.check()
+				if !ok {
+					fmt.Fprint(c.Writer, "event: closed\ndata: {\"error\":\"Access revoked\"}\n\n")
+					c.Writer.Flush()
+					return
+				}
+				events.setProjects(sub, projects)
+			}
+			fmt.Fprint(c.Writer, ": ping\n\n")
+		case event := <-sub.events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		c.Writer.Flush()
+	}
+}
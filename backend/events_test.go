@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamAccessCheck(t *testing.T) {
+	openTestDB(t)
+
+	user := User{Username: "alice", PasswordHash: "x", Role: roleViewer}
+	db.Create(&user)
+	session := Session{UserID: user.ID, TokenHash: "session", ExpiresAt: time.Now().Add(time.Hour)}
+	db.Create(&session)
+	apiKey := APIKey{UserID: user.ID, Name: "ci", KeyHash: "key", Scopes: "read"}
+	db.Create(&apiKey)
+
+	org := Organization{Name: "Acme"}
+	db.Create(&org)
+	db.Create(&OrganizationMember{OrganizationID: org.ID, UserID: user.ID})
+	project := Project{OrganizationID: org.ID, Name: "Site"}
+	db.Create(&project)
+
+	viaSession := streamAccess{userID: user.ID, sessionID: session.ID}
+	viaKey := streamAccess{userID: user.ID, apiKeyID: apiKey.ID}
+
+	projects, ok := viaSession.check()
+	if !ok || !projects[project.ID] {
+		t.Fatalf("check() = %v, %v, want access to project %d", projects, ok, project.ID)
+	}
+
+	// Leaving the organisation drops its projects but keeps the stream
+	db.Where("user_id = ?", user.ID).Delete(&OrganizationMember{})
+	if projects, ok := viaSession.check(); !ok || projects[project.ID] {
+		t.Errorf("after leaving the organisation: check() = %v, %v", projects, ok)
+	}
+
+	db.Model(&session).Update("revoked_at", time.Now())
+	if _, ok := viaSession.check(); ok {
+		t.Error("stream stays open after its session was revoked")
+	}
+
+	if _, ok := viaKey.check(); !ok {
+		t.Error("stream opened with a valid key was closed")
+	}
+	db.Model(&apiKey).Update("revoked_at", time.Now())
+	if _, ok := viaKey.check(); ok {
+		t.Error("stream stays open after its API key was revoked")
+	}
+
+	other := User{Username: "bob", PasswordHash: "x", Role: roleViewer}
+	db.Create(&other)
+	bobSession := Session{UserID: other.ID, TokenHash: "bob", ExpiresAt: time.Now().Add(time.Hour)}
+	db.Create(&bobSession)
+	viaBob := streamAccess{userID: other.ID, sessionID: bobSession.ID}
+	if _, ok := viaBob.check(); !ok {
+		t.Fatal("stream of a valid user was closed")
+	}
+	db.Delete(&other)
+	if _, ok := viaBob.check(); ok {
+		t.Error("stream stays open after its user was deleted")
+	}
+}
+
+func TestEventBusSetProjects(t *testing.T) {
+	bus := &eventBus{subscribers: make(map[*eventSubscriber]struct{})}
+	sub := &eventSubscriber{userID: 1, projects: map[uint]bool{7: true}, events: make(chan CrawlEvent, 4)}
+	bus.subscribe(sub)
+
+	projectID := uint(7)
+	bus.publish(CrawlEvent{Type: "status", URLID: 10, userID: 2, projectID: &projectID})
+	if len(sub.events) != 1 {
+		t.Fatalf("got %d events, want the project's event", len(sub.events))
+	}
+	<-sub.events
+
+	bus.setProjects(sub, map[uint]bool{})
+	bus.publish(CrawlEvent{Type: "status", URLID: 10, userID: 2, projectID: &projectID})
+	bus.publish(CrawlEvent{Type: "status", URLID: 11, userID: 1})
+	if len(sub.events) != 1 {
+		t.Fatalf("got %d events, want only the user's own", len(sub.events))
+	}
+	if event := <-sub.events; event.URLID != 11 {
+		t.Errorf("got event for URL %d, want 11", event.URLID)
+	}
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Export of the URL list. Rows are streamed in batches so large accounts
+// never have to fit in memory.
+const exportBatchSize = 200
+
+type ExportRequest struct {
+	PaginationRequest
+	Format      string `form:"format" binding:"omitempty,oneof=csv jsonl xlsx"`
+	BrokenLinks bool   `form:"broken_links"` // also export the broken links of each URL's latest run
+}
+
+// URLExport is a URL with the broken links of its latest run, for JSON Lines
+type URLExport struct {
+	URL
+	BrokenLinks []BrokenLink `json:"broken_links,omitempty"`
+}
+
+var urlExportHeader = []string{
+	"id", "url", "status", "title", "html_version",
+	"h1_count", "h2_count", "h3_count", "h4_count", "h5_count", "h6_count",
+	"internal_links", "external_links", "inaccessible_links", "has_login_form",
+	"broken_images", "broken_scripts", "broken_stylesheets", "broken_iframes", "broken_media",
+	"crawl_mode", "pages_crawled", "project_id", "error_message", "last_run_at", "created_at", "updated_at",
+}
+
+func urlExportRow(u *URL) []interface{} {
+	var projectID interface{}
+	if u.ProjectID != nil {
+		projectID = *u.ProjectID
+	}
+	var lastRunAt interface{}
+	if u.LastRunAt != nil {
+		lastRunAt = *u.LastRunAt
+	}
+
+	return []interface{}{
+		u.ID, u.URL, u.Status, u.Title, u.HTMLVersion,
+		u.H1Count, u.H2Count, u.H3Count, u.H4Count, u.H5Count, u.H6Count,
+		u.InternalLinks, u.ExternalLinks, u.InaccessibleLinks, u.HasLoginForm,
+		u.BrokenImages, u.BrokenScripts, u.BrokenStylesheets, u.BrokenIframes, u.BrokenMedia,
+		u.CrawlMode, u.PagesCrawled, projectID, u.ErrorMessage, lastRunAt, u.CreatedAt, u.UpdatedAt,
+	}
+}
+
+var brokenLinkExportHeader = []string{
+	"url_id", "page_url", "link_url", "resource_type", "status_code", "error_kind", "error_message",
+}
+
+func brokenLinkExportRow(link *BrokenLink) []interface{} {
+	return []interface{}{
+		link.URLID, link.PageURL, link.LinkURL, link.ResourceType, link.StatusCode, link.ErrorKind, link.ErrorMessage,
+	}
+}
+
+// eachURLBatch streams the rows of a query and hands them over in batches
+func eachURLBatch(query *gorm.DB, fn func([]URL) error) error {
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	batch := make([]URL, 0, exportBatchSize)
+	for rows.Next() {
+		var u URL
+		if err := db.ScanRows(rows, &u); err != nil {
+			return err
+		}
+		batch = append(batch, u)
+
+		if len(batch) == exportBatchSize {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// latestBrokenLinks loads the broken links of the latest run of each URL
+func latestBrokenLinks(urls []URL) (map[uint][]BrokenLink, error) {
+	var runIDs []uint
+	for _, u := range urls {
+		if u.LatestRunID != nil {
+			runIDs = append(runIDs, *u.LatestRunID)
+		}
+	}
+
+	byURL := make(map[uint][]BrokenLink)
+	if len(runIDs) == 0 {
+		return byURL, nil
+	}
+
+	var links []BrokenLink
+	if err := db.Where("run_id IN ?", runIDs).Order("url_id, id").Find(&links).Error; err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		byURL[link.URLID] = append(byURL[link.URLID], link)
+	}
+	return byURL, nil
+}
+
+// tableWriter is a sheet of rows in one of the export formats
+type tableWriter interface {
+	writeRow(values []interface{}) error
+}
+
+type csvTable struct {
+	w *csv.Writer
+}
+
+func (t *csvTable) writeRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		if text, ok := value.(string); ok {
+			record[i] = escapeFormula(text)
+			continue
+		}
+		record[i] = formatExportValue(value)
+	}
+	return t.w.Write(record)
+}
+
+// escapeFormula stops spreadsheet apps from running crawled text, such as a
+// page title of "=HYPERLINK(...)", as a formula by prefixing a quote
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func formatExportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// writeTables writes the URL table and, if requested, the broken links table
+func writeTables(query *gorm.DB, urls, links func() (tableWriter, error), brokenLinks bool) error {
+	table, err := urls()
+	if err != nil {
+		return err
+	}
+	if err := writeHeader(table, urlExportHeader); err != nil {
+		return err
+	}
+	err = eachURLBatch(query, func(batch []URL) error {
+		for i := range batch {
+			if err := table.writeRow(urlExportRow(&batch[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || !brokenLinks {
+		return err
+	}
+
+	table, err = links()
+	if err != nil {
+		return err
+	}
+	if err := writeHeader(table, brokenLinkExportHeader); err != nil {
+		return err
+	}
+	return eachURLBatch(query, func(batch []URL) error {
+		byURL, err := latestBrokenLinks(batch)
+		if err != nil {
+			return err
+		}
+		for _, u := range batch {
+			for i := range byURL[u.ID] {
+				if err := table.writeRow(brokenLinkExportRow(&byURL[u.ID][i])); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func writeHeader(table tableWriter, header []string) error {
+	values := make([]interface{}, len(header))
+	for i, name := range header {
+		values[i] = name
+	}
+	return table.writeRow(values)
+}
+
+// exportCSV writes a single CSV file, or a zip archive with a second CSV
+// file for broken links since CSV has no sheets
+func exportCSV(w io.Writer, query *gorm.DB, brokenLinks bool) error {
+	if !brokenLinks {
+		out := csv.NewWriter(w)
+		if err := writeTables(query, func() (tableWriter, error) { return &csvTable{w: out}, nil }, nil, false); err != nil {
+			return err
+		}
+		out.Flush()
+		return out.Error()
+	}
+
+	archive := zip.NewWriter(w)
+	var current *csv.Writer
+	open := func(name string) (tableWriter, error) {
+		if current != nil {
+			current.Flush()
+			if err := current.Error(); err != nil {
+				return nil, err
+			}
+		}
+		file, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		current = csv.NewWriter(file)
+		return &csvTable{w: current}, nil
+	}
+
+	err := writeTables(query,
+		func() (tableWriter, error) { return open("urls.csv") },
+		func() (tableWriter, error) { return open("broken_links.csv") },
+		true)
+	if err != nil {
+		return err
+	}
+	current.Flush()
+	if err := current.Error(); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// exportJSONL writes one URL per line, with its broken links inlined
+func exportJSONL(w io.Writer, query *gorm.DB, brokenLinks bool) error {
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+
+	err := eachURLBatch(query, func(batch []URL) error {
+		byURL := map[uint][]BrokenLink{}
+		if brokenLinks {
+			var err error
+			if byURL, err = latestBrokenLinks(batch); err != nil {
+				return err
+			}
+		}
+
+		for _, u := range batch {
+			record := URLExport{URL: u, BrokenLinks: byURL[u.ID]}
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return out.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// exportXLSX writes a workbook with a URLs sheet and optionally a broken
+// links sheet. The workbook is assembled by hand with inline strings so it
+// can be streamed row by row.
+func exportXLSX(w io.Writer, query *gorm.DB, brokenLinks bool) error {
+	sheets := []string{"URLs"}
+	if brokenLinks {
+		sheets = append(sheets, "Broken links")
+	}
+
+	archive := zip.NewWriter(w)
+	if err := writeXLSXParts(archive, sheets); err != nil {
+		return err
+	}
+
+	var current *xlsxSheet
+	open := func(index int) (tableWriter, error) {
+		if current != nil {
+			if err := current.close(); err != nil {
+				return nil, err
+			}
+		}
+		file, err := archive.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", index))
+		if err != nil {
+			return nil, err
+		}
+		current = &xlsxSheet{w: bufio.NewWriter(file)}
+		return current, current.open()
+	}
+
+	err := writeTables(query,
+		func() (tableWriter, error) { return open(1) },
+		func() (tableWriter, error) { return open(2) },
+		brokenLinks)
+	if err != nil {
+		return err
+	}
+	if err := current.close(); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// writeXLSXParts writes the package parts that describe the workbook
+func writeXLSXParts(archive *zip.Writer, sheets []string) error {
+	contentTypes := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`
+	workbook := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`
+	workbookRels := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`
+
+	for i, name := range sheets {
+		n := i + 1
+		contentTypes += fmt.Sprintf(`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		workbook += fmt.Sprintf(`<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), n, n)
+		workbookRels += fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	contentTypes += `</Types>`
+	workbook += `</sheets></workbook>`
+	workbookRels += `</Relationships>`
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", workbook},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+	}
+	for _, part := range parts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type xlsxSheet struct {
+	w   *bufio.Writer
+	row int
+}
+
+func (s *xlsxSheet) open() error {
+	_, err := s.w.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return err
+}
+
+func (s *xlsxSheet) close() error {
+	if _, err := s.w.WriteString(`</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *xlsxSheet) writeRow(values []interface{}) error {
+	s.row++
+	fmt.Fprintf(s.w, `<row r="%d">`, s.row)
+	for i, value := range values {
+		ref := xlsxColumn(i) + strconv.Itoa(s.row)
+		switch v := value.(type) {
+		case nil:
+			continue
+		case int, uint:
+			fmt.Fprintf(s.w, `<c r="%s"><v>%v</v></c>`, ref, v)
+		case bool:
+			b := 0
+			if v {
+				b = 1
+			}
+			fmt.Fprintf(s.w, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+		default:
+			// Inline strings are never evaluated as formulas, so text is written as is
+			fmt.Fprintf(s.w, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(formatExportValue(v)))
+		}
+	}
+	_, err := s.w.WriteString(`</row>`)
+	return err
+}
+
+// xlsxColumn converts a zero-based column index to its letters (A, B, ... AA)
+func xlsxColumn(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var out strings.Builder
+	xml.EscapeText(&out, []byte(s))
+	return out.String()
+}
+
+// API Handlers
+func exportURLs(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	var req ExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+
+	// The query runs once per exported table
+	query := filteredURLs(c, &req.PaginationRequest).
+		Order(urlOrder(&req.PaginationRequest)).
+		Session(&gorm.Session{})
+
+	filename := "urls-" + time.Now().Format("20060102-150405")
+	var contentType string
+	var write func(io.Writer, *gorm.DB, bool) error
+	switch req.Format {
+	case "csv":
+		contentType, filename, write = "text/csv; charset=utf-8", filename+".csv", exportCSV
+		if req.BrokenLinks {
+			contentType, filename = "application/zip", strings.TrimSuffix(filename, ".csv")+".zip"
+		}
+	case "jsonl":
+		contentType, filename, write = "application/x-ndjson", filename+".jsonl", exportJSONL
+	case "xlsx":
+		contentType, filename, write = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", filename+".xlsx", exportXLSX
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	// The status is already sent, so a failure can only cut the download short
+	if err := write(c.Writer, query, req.BrokenLinks); err != nil {
+		log.Printf("URL export failed: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"Home page", "Home page"},
+		{"https://example.com/", "https://example.com/"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tindented", "'\tindented"},
+		{"\rcarriage", "'\rcarriage"},
+		{"a=b", "a=b"},
+	}
+
+	for _, tt := range tests {
+		if got := escapeFormula(tt.in); got != tt.want {
+			t.Errorf("escapeFormula(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCSVTableEscapesStrings(t *testing.T) {
+	var buf bytes.Buffer
+	out := csv.NewWriter(&buf)
+	table := &csvTable{w: out}
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := table.writeRow([]interface{}{-1, "=cmd|' /C calc'!A0", "Title", created, nil}); err != nil {
+		t.Fatal(err)
+	}
+	out.Flush()
+
+	record, err := csv.NewReader(&buf).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Numbers are not text and keep their sign
+	want := []string{"-1", "'=cmd|' /C calc'!A0", "Title", "2024-01-02T03:04:05Z", ""}
+	for i := range want {
+		if record[i] != want[i] {
+			t.Errorf("column %d = %q, want %q", i, record[i], want[i])
+		}
+	}
+}
+
+func TestXLSXSheetKeepsStrings(t *testing.T) {
+	var buf bytes.Buffer
+	sheet := &xlsxSheet{w: bufio.NewWriter(&buf)}
+
+	if err := sheet.writeRow([]interface{}{uint(7), "@SUM(A1:A9)", "plain"}); err != nil {
+		t.Fatal(err)
+	}
+	sheet.w.Flush()
+
+	row := buf.String()
+	if !strings.Contains(row, `<c r="A1"><v>7</v></c>`) {
+		t.Errorf("numeric cell not written as a number: %s", row)
+	}
+	// Inline strings aren't evaluated, so formula-like text needs no quote
+	if !strings.Contains(row, `<t xml:space="preserve">@SUM(A1:A9)</t>`) {
+		t.Errorf("formula-like string changed: %s", row)
+	}
+	if !strings.Contains(row, `<t xml:space="preserve">plain</t>`) {
+		t.Errorf("plain string changed: %s", row)
+	}
+}
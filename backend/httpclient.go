@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// crawlPolicy carries the per-URL settings applied to every outbound request of a crawl
+type crawlPolicy struct {
+	IgnoreRobots bool
+	RateLimit    float64 // requests per second per host, 0 uses the global default
+	MaxConns     int     // concurrent requests per host, 0 uses the global default
+}
+
+func crawlPolicyFor(urlRecord *URL) *crawlPolicy {
+	return &crawlPolicy{
+		IgnoreRobots: urlRecord.IgnoreRobots,
+		RateLimit:    urlRecord.RateLimit,
+		MaxConns:     urlRecord.MaxHostConns,
+	}
+}
+
+// Redirect limits; robots.txt follows the five hops RFC 9309 asks for
+const (
+	maxRedirects       = 10
+	maxRobotsRedirects = 5
+)
+
+// doCrawlRequest sends a request on behalf of the crawler, honouring
+// robots.txt rules and crawl delays unless the policy overrides them. Every
+// request goes through the shared per-host limiter. Redirects are followed
+// here rather than by the client so each hop is checked against its own
+// host's robots.txt and limiter; resp.Request is the final hop.
+func doCrawlRequest(ctx context.Context, client *http.Client, req *http.Request, policy *crawlPolicy) (*http.Response, error) {
+	return followRedirects(ctx, req, maxRedirects, func(req *http.Request) (*http.Response, error) {
+		return sendCrawlHop(ctx, client, req, policy)
+	})
+}
+
+// sendCrawlHop sends a single request of a redirect chain
+func sendCrawlHop(ctx context.Context, client *http.Client, req *http.Request, policy *crawlPolicy) (*http.Response, error) {
+	req.Header.Set("User-Agent", crawlerUserAgent)
+
+	var delay time.Duration
+	if !policy.IgnoreRobots {
+		rules, err := robots.rulesFor(ctx, client, req.URL, policy)
+		if err != nil {
+			return nil, err
+		}
+		if !rules.allowed(req.URL) {
+			return nil, errBlockedByRobots
+		}
+
+		// Crawl-delay spaces out every request to the host
+		delay = rules.crawlDelay
+		if limit := time.Duration(getEnvInt("ROBOTS_MAX_CRAWL_DELAY", 30)) * time.Second; delay > limit {
+			delay = limit
+		}
+	}
+
+	return sendLimited(ctx, client, req, policy.RateLimit, policy.MaxConns, delay)
+}
+
+// followRedirects sends req with send and follows up to limit redirects,
+// passing every hop through send
+func followRedirects(ctx context.Context, req *http.Request, limit int, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	for hops := 0; ; hops++ {
+		resp, err := send(req)
+		if err != nil {
+			return nil, err
+		}
+
+		next, err := redirectRequest(ctx, req, resp)
+		if err != nil || next == nil {
+			if err != nil {
+				resp.Body.Close()
+			}
+			return resp, err
+		}
+		if hops >= limit {
+			resp.Body.Close()
+			return nil, fmt.Errorf("stopped after %d redirects", limit)
+		}
+
+		// Free the connection and limiter slot before the next hop
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		req = next
+	}
+}
+
+// redirectRequest returns the request for the next hop of a redirect, or nil
+// if resp is not a redirect. Methods change the way net/http changes them.
+func redirectRequest(ctx context.Context, req *http.Request, resp *http.Response) (*http.Request, error) {
+	method := req.Method
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+		if method != http.MethodGet && method != http.MethodHead {
+			method = http.MethodGet
+		}
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, nil
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, nil
+	}
+	target, err := req.URL.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect location %q: %w", location, err)
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported redirect scheme %q", target.Scheme)
+	}
+
+	next, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	next.Header = req.Header.Clone()
+	return next, nil
+}
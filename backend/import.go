@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bulk import of URLs from an uploaded CSV/TXT file or a sitemap
+const (
+	maxImportFileSize = 5 << 20  // bytes read from an uploaded file
+	maxSitemapSize    = 50 << 20 // the sitemap protocol's limit, uncompressed
+	maxChildSitemaps  = 50       // sitemaps followed from a sitemap index
+)
+
+type ImportRequest struct {
+	SitemapURL string `json:"sitemap_url" form:"sitemap_url"`
+	ProjectID  *uint  `json:"project_id" form:"project_id"`
+	AutoStart  bool   `json:"auto_start" form:"auto_start"`
+}
+
+// ImportEntry is one line of the import report
+type ImportEntry struct {
+	Line   int    `json:"line"`             // line in the file, or position in the sitemap
+	Source string `json:"source,omitempty"` // sitemap the URL was listed in
+	Input  string `json:"input"`
+	URL    string `json:"url,omitempty"` // normalised URL
+	URLID  uint   `json:"url_id,omitempty"`
+	Status string `json:"status"` // created, duplicate, invalid, error
+	Error  string `json:"error,omitempty"`
+}
+
+type ImportResponse struct {
+	Created   int           `json:"created"`
+	Duplicate int           `json:"duplicate"`
+	Invalid   int           `json:"invalid"`
+	Failed    int           `json:"failed"`
+	Queued    int           `json:"queued"`
+	Truncated bool          `json:"truncated"` // more URLs than IMPORT_MAX_URLS were found
+	Entries   []ImportEntry `json:"entries"`
+}
+
+// importSource is a URL read from an upload or sitemap, before validation
+type importSource struct {
+	Line   int
+	Source string
+	Input  string
+	Err    string // set when the entry couldn't be read, e.g. a broken child sitemap
+}
+
+// parseURLList reads one URL per line, skipping blank lines and # comments
+func parseURLList(r io.Reader) ([]importSource, error) {
+	var sources []importSource
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		sources = append(sources, importSource{Line: line, Input: text})
+	}
+
+	return sources, scanner.Err()
+}
+
+// parseURLCSV reads URLs from the "url" column of a CSV file, or from the
+// first column if there is no header naming one
+func parseURLCSV(r io.Reader) ([]importSource, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var sources []importSource
+	column := 0
+	first := true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		if first {
+			first = false
+			header := false
+			for i, field := range record {
+				if strings.EqualFold(strings.TrimSpace(field), "url") {
+					column, header = i, true
+					break
+				}
+			}
+			if header {
+				continue
+			}
+		}
+
+		if column >= len(record) {
+			continue
+		}
+		text := strings.TrimSpace(record[column])
+		if text == "" {
+			continue
+		}
+		sources = append(sources, importSource{Line: line, Input: text})
+	}
+
+	return sources, nil
+}
+
+// Sitemap XML - a urlset lists pages, a sitemapindex lists further sitemaps
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// fetchSitemap downloads and parses one sitemap, gunzipping it if needed
+func fetchSitemap(ctx context.Context, client *http.Client, sitemapURL string) (*sitemapDocument, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sitemaps are published for crawlers, so robots.txt isn't consulted
+	resp, err := doCrawlRequest(ctx, client, req, &crawlPolicy{IgnoreRobots: true})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	body := bufio.NewReader(io.LimitReader(resp.Body, maxSitemapSize))
+	var reader io.Reader = body
+	if magic, _ := body.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = io.LimitReader(gz, maxSitemapSize)
+	}
+
+	var doc sitemapDocument
+	if err := xml.NewDecoder(reader).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid sitemap: %w", err)
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("invalid sitemap: unexpected <%s> element", doc.XMLName.Local)
+	}
+
+	return &doc, nil
+}
+
+// collectSitemapURLs returns the pages listed in a sitemap, following a
+// sitemap index one level down. It stops after limit URLs.
+func collectSitemapURLs(ctx context.Context, client *http.Client, sitemapURL string, limit int) ([]importSource, bool, error) {
+	root, err := fetchSitemap(ctx, client, sitemapURL)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var sources []importSource
+	add := func(doc *sitemapDocument, source string) bool {
+		for i, entry := range doc.URLs {
+			if len(sources) >= limit {
+				return false
+			}
+			sources = append(sources, importSource{Line: i + 1, Source: source, Input: strings.TrimSpace(entry.Loc)})
+		}
+		return true
+	}
+
+	if root.XMLName.Local == "urlset" {
+		complete := add(root, sitemapURL)
+		return sources, !complete, nil
+	}
+
+	truncated := len(root.Sitemaps) > maxChildSitemaps
+	for i, child := range root.Sitemaps {
+		if i >= maxChildSitemaps {
+			break
+		}
+		childURL := strings.TrimSpace(child.Loc)
+
+		doc, err := fetchSitemap(ctx, client, childURL)
+		if err != nil {
+			// A broken child sitemap is reported instead of failing the import
+			sources = append(sources, importSource{Line: i + 1, Source: sitemapURL, Input: childURL, Err: "Failed to fetch sitemap: " + err.Error()})
+			continue
+		}
+		if doc.XMLName.Local != "urlset" {
+			continue // nested indexes aren't part of the protocol
+		}
+		if !add(doc, childURL) {
+			truncated = true
+			break
+		}
+	}
+
+	return sources, truncated, nil
+}
+
+// readImportFile parses an uploaded CSV or plain text file
+func readImportFile(c *gin.Context) ([]importSource, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	if header.Size > maxImportFileSize {
+		return nil, fmt.Errorf("file is larger than %d MB", maxImportFileSize>>20)
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := io.LimitReader(file, maxImportFileSize)
+	if strings.EqualFold(filepath.Ext(header.Filename), ".csv") || strings.Contains(header.Header.Get("Content-Type"), "csv") {
+		return parseURLCSV(reader)
+	}
+	return parseURLList(reader)
+}
+
+// API Handlers
+func importURLs(c *gin.Context) {
+	var req ImportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	if req.ProjectID != nil {
+		var project Project
+		if err := accessibleProjects(c).First(&project, *req.ProjectID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return
+		}
+	}
+
+	limit := getEnvInt("IMPORT_MAX_URLS", 1000)
+
+	var sources []importSource
+	truncated := false
+	switch {
+	case req.SitemapURL != "":
+		sitemapURL, err := normalizeURL(req.SitemapURL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sitemap URL: " + err.Error()})
+			return
+		}
+		sources, truncated, err = collectSitemapURLs(c.Request.Context(), newCrawlClient(30*time.Second), sitemapURL, limit)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch sitemap: " + err.Error()})
+			return
+		}
+	default:
+		var err error
+		sources, err = readImportFile(c)
+		if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Upload a file or provide a sitemap_url"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file: " + err.Error()})
+			return
+		}
+		if len(sources) > limit {
+			sources, truncated = sources[:limit], true
+		}
+	}
+
+	response := ImportResponse{Truncated: truncated, Entries: []ImportEntry{}}
+	var startIDs []uint
+	for _, source := range sources {
+		entry := ImportEntry{Line: source.Line, Source: source.Source, Input: source.Input}
+		if source.Err != "" {
+			entry.Status = "error"
+			entry.Error = source.Err
+			response.Failed++
+			response.Entries = append(response.Entries, entry)
+			continue
+		}
+
+		normalized, err := normalizeURL(source.Input)
+		if err != nil {
+			entry.Status = "invalid"
+			entry.Error = err.Error()
+			response.Invalid++
+			response.Entries = append(response.Entries, entry)
+			continue
+		}
+		entry.URL = normalized
+
+		urlRecord := URL{
+			UserID:       c.GetUint("user_id"),
+			ProjectID:    req.ProjectID,
+			URL:          normalized,
+			Status:       "pending",
+			CrawlMode:    "page",
+			Scope:        "host",
+			MaxDepth:     defaultSiteMaxDepth,
+			PageAnalysis: PageAnalysis{Title: "Untitled"},
+		}
+		created, err := createOrFindURL(&urlRecord)
+		switch {
+		case err != nil:
+			entry.Status = "error"
+			entry.Error = "Failed to save URL"
+			response.Failed++
+		case created:
+			entry.Status = "created"
+			response.Created++
+		default:
+			entry.Status = "duplicate"
+			response.Duplicate++
+		}
+		entry.URLID = urlRecord.ID
+		if err == nil {
+			startIDs = append(startIDs, urlRecord.ID)
+		}
+
+		response.Entries = append(response.Entries, entry)
+	}
+
+	// Queue every imported URL that isn't already queued or running
+	if req.AutoStart && len(startIDs) > 0 {
+		result := db.Model(&URL{}).
+			Where("id IN ? AND status NOT IN ?", startIDs, []string{"queued", "running"}).
+			Update("status", "queued")
+		if result.Error == nil {
+			response.Queued = int(result.RowsAffected)
+			for i := 0; i < response.Queued; i++ {
+				queue.notify()
+			}
+			publishStatusOf(startIDs)
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseURLList(t *testing.T) {
+	input := "https://example.com/a\n\n  # a comment\n  example.com/b  \nnot a url\nhttps://example.com/a\n"
+
+	sources, err := parseURLList(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid and duplicate lines are kept so the report can list them
+	want := []importSource{
+		{Line: 1, Input: "https://example.com/a"},
+		{Line: 4, Input: "example.com/b"},
+		{Line: 5, Input: "not a url"},
+		{Line: 6, Input: "https://example.com/a"},
+	}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("parseURLList() = %+v, want %+v", sources, want)
+	}
+}
+
+func TestParseURLCSV(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []importSource
+	}{
+		{
+			name:  "header names the url column",
+			input: "name,URL\nHome,https://example.com/\nDocs, example.com/docs\n",
+			want: []importSource{
+				{Line: 2, Input: "https://example.com/"},
+				{Line: 3, Input: "example.com/docs"},
+			},
+		},
+		{
+			name:  "without header the first column is used",
+			input: "https://example.com/,Home\nexample.com/docs,Docs\n",
+			want: []importSource{
+				{Line: 1, Input: "https://example.com/"},
+				{Line: 2, Input: "example.com/docs"},
+			},
+		},
+		{
+			name:  "duplicate and invalid rows are kept",
+			input: "url\nhttps://example.com/\nftp://example.com/\nhttps://example.com/\n",
+			want: []importSource{
+				{Line: 2, Input: "https://example.com/"},
+				{Line: 3, Input: "ftp://example.com/"},
+				{Line: 4, Input: "https://example.com/"},
+			},
+		},
+		{
+			name:  "short and empty rows are skipped",
+			input: "name,url\nOnly a name\nEmpty,\nDocs,https://example.com/docs\n",
+			want: []importSource{
+				{Line: 4, Input: "https://example.com/docs"},
+			},
+		},
+		{
+			name:  "quoted fields spanning lines",
+			input: "\"note\nover two lines\",url\n\"x\",https://example.com/\n",
+			want: []importSource{
+				{Line: 3, Input: "https://example.com/"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources, err := parseURLCSV(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(sources, tt.want) {
+				t.Errorf("parseURLCSV() = %+v, want %+v", sources, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseURLCSVMalformed(t *testing.T) {
+	if _, err := parseURLCSV(strings.NewReader("url\n\"https://example.com/\n")); err == nil {
+		t.Error("unterminated quote should be an error")
+	}
+}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCollectSitemapURLs(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>` + server.URL + `/pages.xml</loc></sitemap>
+  <sitemap><loc> ` + server.URL + `/posts.xml.gz </loc></sitemap>
+  <sitemap><loc>` + server.URL + `/broken.xml</loc></sitemap>
+  <sitemap><loc>` + server.URL + `/missing.xml</loc></sitemap>
+  <sitemap><loc>` + server.URL + `/nested.xml</loc></sitemap>
+</sitemapindex>`))
+		case "/pages.xml":
+			w.Write([]byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/</loc></url>
+  <url><loc> https://example.com/about </loc></url>
+</urlset>`))
+		case "/posts.xml.gz":
+			w.Write(gzipBytes(t, `<urlset><url><loc>https://example.com/posts/1</loc></url></urlset>`))
+		case "/broken.xml":
+			w.Write([]byte(`<urlset><url><loc>https://example.com/unclosed`))
+		case "/nested.xml":
+			w.Write([]byte(`<sitemapindex><sitemap><loc>` + server.URL + `/pages.xml</loc></sitemap></sitemapindex>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	sources, truncated, err := collectSitemapURLs(context.Background(), http.DefaultClient, server.URL+"/sitemap.xml", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if truncated {
+		t.Error("truncated = true, want false")
+	}
+
+	var inputs, failed []string
+	for _, source := range sources {
+		if source.Err != "" {
+			failed = append(failed, strings.TrimPrefix(source.Input, server.URL))
+			continue
+		}
+		inputs = append(inputs, source.Input)
+	}
+
+	// Nested indexes are not followed
+	wantInputs := []string{"https://example.com/", "https://example.com/about", "https://example.com/posts/1"}
+	if !reflect.DeepEqual(inputs, wantInputs) {
+		t.Errorf("URLs = %v, want %v", inputs, wantInputs)
+	}
+	// Broken child sitemaps are reported, not fatal
+	wantFailed := []string{"/broken.xml", "/missing.xml"}
+	if !reflect.DeepEqual(failed, wantFailed) {
+		t.Errorf("failed sitemaps = %v, want %v", failed, wantFailed)
+	}
+
+	if sources[0].Source != server.URL+"/pages.xml" || sources[0].Line != 1 {
+		t.Errorf("first entry = %+v, want line 1 of pages.xml", sources[0])
+	}
+
+	// The limit applies across child sitemaps
+	sources, truncated, err = collectSitemapURLs(context.Background(), http.DefaultClient, server.URL+"/sitemap.xml", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !truncated || len(sources) != 2 {
+		t.Errorf("with limit 2: %d URLs, truncated = %v", len(sources), truncated)
+	}
+}
+
+func TestCollectSitemapURLsInvalidRoot(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed XML", `<urlset><url><loc>https://example.com/</url>`},
+		{"not a sitemap", `<html><body>Not found</body></html>`},
+		{"empty body", ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			if _, _, err := collectSitemapURLs(context.Background(), http.DefaultClient, server.URL, 100); err == nil {
+				t.Error("want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestLinkTargets(t *testing.T) {
+	links := []linkRef{
+		{URL: "/about", Type: "link"},
+		{URL: "https://other.com/page", Type: "link"},
+		{URL: "https://other.com/upper", Type: "link"},
+		{URL: "/about", Type: "link"}, // duplicate
+		{URL: "#top", Type: "link"},
+		{URL: "", Type: "link"},
+		{URL: "mailto:a@example.com", Type: "link"},
+		{URL: "MAILTO:a@example.com", Type: "link"},
+		{URL: "tel:+123", Type: "link"},
+		{URL: "javascript:void(0)", Type: "link"},
+		{URL: "data:image/png;base64,AAAA", Type: "image"},
+		{URL: "ftp://files.example.com/a", Type: "link"},
+		{URL: "sms:+123", Type: "link"},
+		{URL: "skype:someone?call", Type: "link"},
+		{URL: "img/logo.png", Type: "image"},
+	}
+
+	got := linkTargets(links, "https://example.com/dir/page")
+	want := []string{
+		"https://example.com/about",
+		"https://other.com/page",
+		"https://other.com/upper",
+		"https://example.com/dir/img/logo.png",
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d targets %v, want %v", len(got), got, want)
+	}
+	for i, target := range got {
+		if target.URL != want[i] {
+			t.Errorf("target %d = %q, want %q", i, target.URL, want[i])
+		}
+	}
+	if got[3].Type != "image" {
+		t.Errorf("resource type = %q, want image", got[3].Type)
+	}
+}
@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -22,15 +30,54 @@ import (
 
 // Database Models
 type URL struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	URL         string    `json:"url" gorm:"unique;not null"`
-	Title       string    `json:"title"`
-	HTMLVersion string    `json:"html_version"`
-	Status      string    `json:"status" gorm:"default:'queued'"` // queued, running, done, error
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_user_url;not null;default:0"` // owner
+	ProjectID *uint     `json:"project_id" gorm:"index"`
+	URL       string    `json:"url" gorm:"size:191;uniqueIndex:idx_user_url;not null"`
+	Status    string    `json:"status" gorm:"default:'pending'"` // pending, queued, running, done, error, stopped, blocked
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Crawl settings - site mode follows internal links from this page
+	CrawlMode      string `json:"crawl_mode" gorm:"default:'page'"` // page, site
+	MaxDepth       int    `json:"max_depth"`
+	MaxPages       int    `json:"max_pages"`
+	Scope          string `json:"scope" gorm:"default:'host'"` // host, subdomain
+	IncludePattern string `json:"include_pattern"`
+	ExcludePattern string `json:"exclude_pattern"`
+	PagesCrawled   int    `json:"pages_crawled"`
+	IgnoreRobots   bool   `json:"ignore_robots"` // for sites we own
+	AllowNoindex   bool   `json:"allow_noindex"` // pages are meant to stay out of search results
+
+	// Per-host politeness overrides - zero uses the global limiter settings
+	RateLimit    float64 `json:"rate_limit"` // requests per second
+	MaxHostConns int     `json:"max_host_conns"`
+
+	// Recurring crawls - either a cron expression or a fixed interval
+	ScheduleCron     string     `json:"schedule_cron"`
+	ScheduleInterval int        `json:"schedule_interval"` // seconds
+	ScheduleJitter   int        `json:"schedule_jitter"`   // seconds
+	SchedulePaused   bool       `json:"schedule_paused"`
+	NextRunAt        *time.Time `json:"next_run_at" gorm:"index"`
+	LastRunAt        *time.Time `json:"last_run_at"`
+
+	// Most recent crawl run - older runs are kept as history
+	LatestRunID *uint `json:"latest_run_id"`
+
+	// Queue bookkeeping - set by the worker that claimed the URL
+	ClaimedBy     string     `json:"claimed_by,omitempty" gorm:"size:191;index"`
+	HeartbeatAt   *time.Time `json:"heartbeat_at,omitempty"`
+	StopRequested bool       `json:"-"`
 
 	// Analysis results - will be populated by crawler
+	PageAnalysis
+	ErrorMessage string `json:"error_message"`
+}
+
+// PageAnalysis holds the results of analysing a single HTML page
+type PageAnalysis struct {
+	Title             string `json:"title"`
+	HTMLVersion       string `json:"html_version"`
 	H1Count           int    `json:"h1_count"`
 	H2Count           int    `json:"h2_count"`
 	H3Count           int    `json:"h3_count"`
@@ -41,21 +88,55 @@ type URL struct {
 	ExternalLinks     int    `json:"external_links"`
 	InaccessibleLinks int    `json:"inaccessible_links"`
 	HasLoginForm      bool   `json:"has_login_form"`
-	ErrorMessage      string `json:"error_message"`
+
+	// Page quality checks
+	SEOIssues          int `json:"seo_issues"`          // SEO findings other than notices
+	AccessibilityScore int `json:"accessibility_score"` // 0-100
+
+	// Broken assets by resource type
+	BrokenImages      int `json:"broken_images"`
+	BrokenScripts     int `json:"broken_scripts"`
+	BrokenStylesheets int `json:"broken_stylesheets"`
+	BrokenIframes     int `json:"broken_iframes"`
+	BrokenMedia       int `json:"broken_media"`
 }
 
 type BrokenLink struct {
-	ID         uint      `json:"id" gorm:"primaryKey"`
-	URLID      uint      `json:"url_id"`
-	URL        *URL      `json:"url" gorm:"foreignKey:URLID"`
-	LinkURL    string    `json:"link_url"`
-	StatusCode int       `json:"status_code"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID           uint   `json:"id" gorm:"primaryKey"`
+	URLID        uint   `json:"url_id"`
+	RunID        uint   `json:"run_id" gorm:"index"`
+	URL          *URL   `json:"url" gorm:"foreignKey:URLID"`
+	PageURL      string `json:"page_url"` // page the link was found on
+	LinkURL      string `json:"link_url"`
+	ResourceType string `json:"resource_type" gorm:"default:'link'"` // link, image, script, stylesheet, iframe, media
+	StatusCode   int    `json:"status_code"`                         // 0 when the link could not be reached
+
+	// Network failures - dns, timeout, tls, refused, other
+	ErrorKind    string    `json:"error_kind,omitempty"`
+	ErrorMessage string    `json:"error_message,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 // Request/Response types
 type CrawlRequest struct {
-	URL string `json:"url" binding:"required"`
+	URL       string `json:"url" binding:"required"`
+	ProjectID *uint  `json:"project_id"`
+	Mode      string `json:"mode" binding:"omitempty,oneof=page site"`
+	MaxDepth  *int   `json:"max_depth" binding:"omitempty,min=0"` // 0 crawls the root page only
+	MaxPages  int    `json:"max_pages" binding:"min=0"`
+	Scope     string `json:"scope" binding:"omitempty,oneof=host subdomain"`
+	Include   string `json:"include"` // regex on the URL path
+	Exclude   string `json:"exclude"` // regex on the URL path
+
+	// Skip robots.txt checks - only for sites we own
+	IgnoreRobots bool `json:"ignore_robots"`
+
+	// Don't report noindex pages as an SEO problem
+	AllowNoindex bool `json:"allow_noindex"`
+
+	// Per-host politeness overrides
+	RateLimit    float64 `json:"rate_limit" binding:"min=0"`
+	MaxHostConns int     `json:"max_host_conns" binding:"min=0"`
 }
 
 type BulkActionRequest struct {
@@ -70,6 +151,7 @@ type PaginationRequest struct {
 	Order    string `json:"order" form:"order"`
 	Search   string `json:"search" form:"search"`
 	Filter   string `json:"filter" form:"filter"`
+	Project  uint   `json:"project_id" form:"project_id"`
 }
 
 type PaginatedResponse struct {
@@ -81,18 +163,71 @@ type PaginatedResponse struct {
 }
 
 type URLDetailResponse struct {
-	URL         URL          `json:"url"`
-	BrokenLinks []BrokenLink `json:"broken_links"`
+	URL            URL                  `json:"url"`
+	BrokenLinks    []BrokenLink         `json:"broken_links"`
+	BrokenAssets   []BrokenLink         `json:"broken_assets"`
+	Pages          []CrawledPage        `json:"pages,omitempty"`
+	Site           *SiteSummary         `json:"site,omitempty"`
+	Meta           []PageMeta           `json:"meta"`
+	StructuredData []StructuredData     `json:"structured_data"`
+	Accessibility  []AccessibilityAudit `json:"accessibility"`
 }
 
 // Global variables
 var db *gorm.DB
-var jwtSecret = []byte("your-secret-key-change-in-production")
+
+// Running crawl registry - lets stop requests cancel in-flight crawls
+type crawlRegistry struct {
+	mu      sync.Mutex
+	cancels map[uint]context.CancelFunc
+}
+
+var runningCrawls = &crawlRegistry{cancels: make(map[uint]context.CancelFunc)}
+
+// register creates a cancellable context for a crawl. It returns false if
+// the URL is already being crawled.
+func (r *crawlRegistry) register(urlID uint) (context.Context, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.cancels[urlID]; exists {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancels[urlID] = cancel
+	return ctx, true
+}
+
+// cancel aborts a running crawl. It returns false if no crawl is running.
+func (r *crawlRegistry) cancel(urlID uint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cancel, exists := r.cancels[urlID]
+	if exists {
+		cancel()
+	}
+	return exists
+}
+
+// finish removes a crawl from the registry and releases its context.
+func (r *crawlRegistry) finish(urlID uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cancel, exists := r.cancels[urlID]; exists {
+		cancel()
+		delete(r.cancels, urlID)
+	}
+}
 
 // JWT Claims
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID uint   `json:"sid"`
 	jwt.RegisteredClaims
 }
 
@@ -144,11 +279,21 @@ func connectDB() {
 		var err error
 		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
 		if err == nil {
+			// Databases from before the crawl queue lack its columns until
+			// they are migrated
+			queueMigration := !db.Migrator().HasColumn(&URL{}, "claimed_by")
+
 			// Auto migrate
-			if err := db.AutoMigrate(&URL{}, &BrokenLink{}); err != nil {
+			if err := db.AutoMigrate(&URL{}, &BrokenLink{}, &CrawledPage{}, &CrawlRun{}, &User{}, &Session{}, &StreamTicket{}, &APIKey{}, &Organization{}, &OrganizationMember{}, &Project{}, &Webhook{}, &WebhookDelivery{}, &PageMeta{}, &StructuredData{}, &AccessibilityAudit{}); err != nil {
 				log.Printf("Failed to migrate database: %v", err)
 			} else {
 				log.Println("Database connected and migrated successfully")
+				bootstrapAdmin()
+				ensureAdmin()
+				migrateURLOwnership()
+				if queueMigration {
+					migrateQueuedURLs()
+				}
 			}
 			return
 		}
@@ -165,12 +310,47 @@ func connectDB() {
 	log.Println("Note: Application will continue without database - some features may not work")
 }
 
+// getEnvInt reads an integer setting from the environment
+func getEnvInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// getEnvFloat reads a decimal setting from the environment
+func getEnvFloat(key string, fallback float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return fallback
+}
+
 // JWT Middleware
 func authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Machine clients authenticate with an API key instead of a JWT
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			user, apiKey, err := authenticateAPIKey(key)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				c.Abort()
+				return
+			}
+
+			c.Set("user_id", user.ID)
+			c.Set("username", user.Username)
+			c.Set("role", user.Role)
+			c.Set("api_key_id", apiKey.ID)
+			c.Set("api_key_scopes", apiKey.Scopes)
+
+			c.Next()
+			return
+		}
+
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header or API key required"})
 			c.Abort()
 			return
 		}
@@ -180,43 +360,47 @@ func authMiddleware() gin.HandlerFunc {
 			tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 		}
 
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := parseAccessToken(tokenString)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		if claims, ok := token.Claims.(*Claims); ok {
-			c.Set("user_id", claims.UserID)
-			c.Set("username", claims.Username)
+		// Tokens of a logged out session are rejected before they expire
+		if db != nil && !sessionActive(claims.SessionID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
 		}
 
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("role", claims.Role)
+		c.Set("session_id", claims.SessionID)
+
 		c.Next()
 	}
 }
 
-// Generate JWT Token
-func generateToken(userID uint, username string) (string, error) {
+// Generate a short-lived JWT access token for a session
+func generateToken(user *User, sessionID uint, ttl time.Duration) (string, error) {
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return jwtKeys.sign(claims)
 }
 
 // Auth endpoints
 func login(c *gin.Context) {
-	// Simple login for demo - in production, validate against user database
 	var loginReq struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
@@ -227,155 +411,243 @@ func login(c *gin.Context) {
 		return
 	}
 
-	// Demo credentials - in production, hash passwords and check against database
-	if loginReq.Username == "admin" && loginReq.Password == "password" {
-		token, err := generateToken(1, loginReq.Username)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-			return
-		}
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
 
-		c.JSON(http.StatusOK, gin.H{
-			"token":    token,
-			"username": loginReq.Username,
-		})
+	// Validate credentials against the users table
+	user, err := authenticateUser(loginReq.Username, loginReq.Password)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	tokens, err := issueTokens(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	c.JSON(http.StatusOK, tokens)
 }
 
 // Web Crawling Engine
-func crawlURL(urlStr string) (*URL, []BrokenLink, error) {
+func crawlURL(ctx context.Context, urlID uint) (*URL, []BrokenLink, error) {
 	// Find existing URL record instead of creating a new one
 	var urlRecord URL
-	if err := db.Where("url = ?", urlStr).First(&urlRecord).Error; err != nil {
+	if err := db.First(&urlRecord, urlID).Error; err != nil {
 		return nil, nil, fmt.Errorf("URL record not found: %w", err)
 	}
+	urlStr := urlRecord.URL
+
+	// Record a new run; results of earlier runs are kept
+	run, err := startRun(&urlRecord)
+	if err != nil {
+		return &urlRecord, nil, fmt.Errorf("failed to create crawl run: %w", err)
+	}
 
 	// Update to running status
 	urlRecord.Status = "running"
-	db.Save(&urlRecord)
+	urlRecord.LatestRunID = &run.ID
+	urlRecord.LastRunAt = &run.StartedAt
+	saveURL(&urlRecord)
+	publishStatus(&urlRecord)
 
-	log.Printf("Starting to crawl URL: %s (ID: %d)", urlStr, urlRecord.ID)
+	log.Printf("Starting to crawl URL: %s (ID: %d, run: %d)", urlStr, urlRecord.ID, run.ID)
 
 	// Fetch the page
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	client := newCrawlClient(30 * time.Second)
 
-	resp, err := client.Get(urlStr)
-	if err != nil {
-		urlRecord.Status = "error"
-		urlRecord.ErrorMessage = err.Error()
-		db.Save(&urlRecord)
-		log.Printf("Failed to fetch URL %s: %v", urlStr, err)
-		return &urlRecord, nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		urlRecord.Status = "error"
-		urlRecord.ErrorMessage = fmt.Sprintf("HTTP %d", resp.StatusCode)
-		db.Save(&urlRecord)
-		log.Printf("HTTP error for URL %s: %d", urlStr, resp.StatusCode)
-		return &urlRecord, nil, fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
+	policy := crawlPolicyFor(&urlRecord)
 
-	// Parse HTML
-	doc, err := html.Parse(resp.Body)
+	doc, _, err := fetchPage(ctx, client, urlStr, policy)
 	if err != nil {
-		urlRecord.Status = "error"
-		urlRecord.ErrorMessage = "Failed to parse HTML"
-		db.Save(&urlRecord)
-		log.Printf("Failed to parse HTML for URL %s: %v", urlStr, err)
+		if ctx.Err() != nil {
+			return markStopped(&urlRecord, run, nil)
+		}
+		if errors.Is(err, errBlockedByRobots) {
+			finishRun(&urlRecord, run, "blocked", err.Error())
+			log.Printf("URL %s is disallowed by robots.txt", urlStr)
+			return &urlRecord, nil, err
+		}
+		if message, blocked := blockedAddressMessage(err); blocked {
+			finishRun(&urlRecord, run, "error", message)
+			log.Printf("URL %s points to a non-public address", urlStr)
+			return &urlRecord, nil, err
+		}
+		finishRun(&urlRecord, run, "error", err.Error())
+		log.Printf("Failed to fetch URL %s: %v", urlStr, err)
 		return &urlRecord, nil, err
 	}
 
 	log.Printf("Successfully parsed HTML for URL: %s", urlStr)
 
-	// Reset counters before analysis
-	urlRecord.H1Count = 0
-	urlRecord.H2Count = 0
-	urlRecord.H3Count = 0
-	urlRecord.H4Count = 0
-	urlRecord.H5Count = 0
-	urlRecord.H6Count = 0
-	urlRecord.InternalLinks = 0
-	urlRecord.ExternalLinks = 0
-	urlRecord.HasLoginForm = false
+	// Reset every result, including the title, so nothing from the previous
+	// crawl carries over to a page that no longer has it
+	urlRecord.PageAnalysis = PageAnalysis{}
+	urlRecord.PagesCrawled = 0
 
 	// Analyze the document
-	analyzeDocument(doc, &urlRecord, urlStr)
+	seen := newMetaIndex()
+	analyzePage(doc, &urlRecord.PageAnalysis, &urlRecord, run, urlStr, seen)
 
 	log.Printf("Analysis completed for URL %s: H1=%d, H2=%d, Internal=%d, External=%d",
 		urlStr, urlRecord.H1Count, urlRecord.H2Count, urlRecord.InternalLinks, urlRecord.ExternalLinks)
 
-	// Delete existing broken links for this URL
-	db.Where("url_id = ?", urlRecord.ID).Delete(&BrokenLink{})
-
 	// Find broken links
-	brokenLinks := findBrokenLinks(doc, urlStr, urlRecord.ID)
-	urlRecord.InaccessibleLinks = len(brokenLinks)
+	progress := newCrawlProgress(&urlRecord, run)
+	brokenLinks := findBrokenLinks(ctx, doc, urlStr, run, policy, progress)
+	countBrokenLinks(&urlRecord.PageAnalysis, brokenLinks)
+	urlRecord.PagesCrawled = 1
+	progress.pageVisited()
+
+	// Follow internal links when crawling the whole site
+	if urlRecord.CrawlMode == "site" && ctx.Err() == nil {
+		siteBrokenLinks := crawlSite(ctx, client, &urlRecord, run, doc, policy, progress, seen)
+		brokenLinks = append(brokenLinks, siteBrokenLinks...)
+	}
+
+	// The run keeps its own copy of the analysis
+	run.PageAnalysis = urlRecord.PageAnalysis
+	run.PagesCrawled = urlRecord.PagesCrawled
+
+	// Keep the partial analysis if the crawl was stopped while checking links
+	if ctx.Err() != nil {
+		return markStopped(&urlRecord, run, brokenLinks)
+	}
 
 	log.Printf("Found %d broken links for URL: %s", len(brokenLinks), urlStr)
 
-	// Update status to done
-	urlRecord.Status = "done"
-	urlRecord.ErrorMessage = "" // Clear any previous errors
-	db.Save(&urlRecord)
+	// Update status to done and clear any previous errors
+	finishRun(&urlRecord, run, "done", "")
 
 	log.Printf("Crawling completed successfully for URL: %s", urlStr)
 
 	return &urlRecord, brokenLinks, nil
 }
 
-func analyzeDocument(n *html.Node, urlRecord *URL, baseURL string) {
+// fetchPage downloads a page and parses it as HTML. It also returns the URL
+// the page was served from after following redirects.
+func fetchPage(ctx context.Context, client *http.Client, pageURL string, policy *crawlPolicy) (*html.Node, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := doCrawlRequest(ctx, client, req, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	// Site crawls discover links to PDFs, images and so on - only parse HTML
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, nil, fmt.Errorf("Unsupported content type: %s", contentType)
+	}
+
+	doc, err := html.Parse(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse HTML: %w", err)
+	}
+
+	return doc, resp.Request.URL, nil
+}
+
+// saveURL persists crawl results without touching the queue bookkeeping
+// columns owned by the worker or a schedule edited during the crawl.
+func saveURL(urlRecord *URL) {
+	omit := append(append([]string{}, queueColumns...), scheduleColumns...)
+	db.Omit(omit...).Save(urlRecord)
+}
+
+// markStopped records a crawl that was cancelled, keeping whatever results
+// were gathered before the stop request arrived.
+func markStopped(urlRecord *URL, run *CrawlRun, brokenLinks []BrokenLink) (*URL, []BrokenLink, error) {
+	finishRun(urlRecord, run, "stopped", "Crawling stopped by user")
+
+	log.Printf("Crawling stopped for URL: %s", urlRecord.URL)
+
+	return urlRecord, brokenLinks, context.Canceled
+}
+
+// analyzePage analyses one crawled page and records its SEO metadata,
+// structured data and accessibility audit for the run. seen spots titles and
+// descriptions repeated across the pages of the run.
+func analyzePage(doc *html.Node, analysis *PageAnalysis, urlRecord *URL, run *CrawlRun, pageURL string, seen *metaIndex) {
+	meta := PageMeta{URLID: urlRecord.ID, RunID: run.ID, PageURL: pageURL}
+	analyzeDocument(doc, analysis, &meta, pageURL)
+	meta.validate(analysis, urlRecord.AllowNoindex)
+	seen.check(&meta, analysis)
+	if err := db.Create(&meta).Error; err != nil {
+		log.Printf("Failed to save page metadata for %s: %v", pageURL, err)
+	}
+
+	audit := AccessibilityAudit{URLID: urlRecord.ID, RunID: run.ID, PageURL: pageURL}
+	audit.run(doc)
+	analysis.AccessibilityScore = audit.Score
+	if err := db.Create(&audit).Error; err != nil {
+		log.Printf("Failed to save accessibility audit for %s: %v", pageURL, err)
+	}
+}
+
+// analyzeDocument counts the elements of a page into analysis and collects
+// its SEO metadata and structured data into meta, which may be nil
+func analyzeDocument(n *html.Node, analysis *PageAnalysis, meta *PageMeta, baseURL string) {
 	if n.Type == html.ElementNode {
+		collectStructuredData(n, meta, baseURL)
+
 		switch n.Data {
 		case "html":
 			// Check for HTML version
 			for _, attr := range n.Attr {
 				if attr.Key == "version" {
-					urlRecord.HTMLVersion = attr.Val
+					analysis.HTMLVersion = attr.Val
 				}
 			}
 			// Default to HTML5 if no version specified
-			if urlRecord.HTMLVersion == "" {
-				urlRecord.HTMLVersion = "HTML5"
+			if analysis.HTMLVersion == "" {
+				analysis.HTMLVersion = "HTML5"
 			}
 		case "title":
 			if n.FirstChild != nil {
-				urlRecord.Title = n.FirstChild.Data
+				analysis.Title = n.FirstChild.Data
 			}
 		case "h1":
-			urlRecord.H1Count++
+			analysis.H1Count++
 		case "h2":
-			urlRecord.H2Count++
+			analysis.H2Count++
 		case "h3":
-			urlRecord.H3Count++
+			analysis.H3Count++
 		case "h4":
-			urlRecord.H4Count++
+			analysis.H4Count++
 		case "h5":
-			urlRecord.H5Count++
+			analysis.H5Count++
 		case "h6":
-			urlRecord.H6Count++
+			analysis.H6Count++
 		case "a":
 			// Analyze links
 			for _, attr := range n.Attr {
 				if attr.Key == "href" {
 					if isInternalLink(attr.Val, baseURL) {
-						urlRecord.InternalLinks++
+						analysis.InternalLinks++
 					} else {
-						urlRecord.ExternalLinks++
+						analysis.ExternalLinks++
 					}
 				}
 			}
 		case "form":
 			// Check for login form
 			if hasLoginForm(n) {
-				urlRecord.HasLoginForm = true
+				analysis.HasLoginForm = true
 			}
+		case "meta", "link":
+			collectMeta(n, meta, baseURL)
 		}
 	}
 
@@ -384,18 +656,18 @@ func analyzeDocument(n *html.Node, urlRecord *URL, baseURL string) {
 		doctype := strings.ToLower(n.Data)
 		if strings.Contains(doctype, "html") {
 			if strings.Contains(doctype, "4.01") {
-				urlRecord.HTMLVersion = "HTML 4.01"
+				analysis.HTMLVersion = "HTML 4.01"
 			} else if strings.Contains(doctype, "xhtml") {
-				urlRecord.HTMLVersion = "XHTML"
+				analysis.HTMLVersion = "XHTML"
 			} else {
-				urlRecord.HTMLVersion = "HTML5"
+				analysis.HTMLVersion = "HTML5"
 			}
 		}
 	}
 
 	// Recursively analyze child nodes
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		analyzeDocument(c, urlRecord, baseURL)
+		analyzeDocument(c, analysis, meta, baseURL)
 	}
 }
 
@@ -451,59 +723,262 @@ func hasLoginForm(n *html.Node) bool {
 	return false
 }
 
-func findBrokenLinks(n *html.Node, baseURL string, urlID uint) []BrokenLink {
-	var brokenLinks []BrokenLink
-	var links []string
-
-	// Collect all links
-	collectLinks(n, &links)
-
-	// Test each link (limit to first 10 for performance)
-	count := 0
+// linkTargets resolves links against the page URL and returns each
+// distinct http(s) target once. mailto:, tel:, javascript:, data: and any
+// other scheme are skipped, whatever their case.
+func linkTargets(links []linkRef, baseURL string) []linkRef {
+	seen := make(map[string]bool)
+	var targets []linkRef
 	for _, link := range links {
-		if count >= 10 { // Limit for demo
-			break
+		href := strings.TrimSpace(link.URL)
+		if href == "" || strings.HasPrefix(href, "#") {
+			continue
 		}
 
-		if link == "" || strings.HasPrefix(link, "#") || strings.HasPrefix(link, "mailto:") || strings.HasPrefix(link, "tel:") {
+		fullURL := resolveURL(href, baseURL)
+		if fullURL == "" || seen[fullURL] {
 			continue
 		}
-
-		fullURL := resolveURL(link, baseURL)
-		if fullURL == "" {
+		u, err := url.Parse(fullURL)
+		if err != nil {
+			continue
+		}
+		if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
 			continue
 		}
 
-		// Make HEAD request to check if link is accessible
-		client := &http.Client{
-			Timeout: 5 * time.Second,
+		seen[fullURL] = true
+		targets = append(targets, linkRef{URL: fullURL, Type: link.Type})
+	}
+	return targets
+}
+
+func findBrokenLinks(ctx context.Context, n *html.Node, baseURL string, run *CrawlRun, policy *crawlPolicy, progress *crawlProgress) []BrokenLink {
+	var links []linkRef
+
+	// Collect all links and embedded resources
+	collectLinks(n, &links)
+
+	targets := linkTargets(links, baseURL)
+
+	client := newCrawlClient(10 * time.Second)
+	progress.linksFound(len(targets))
+
+	// Check links concurrently with a bounded pool; the host limiter still
+	// applies to every request
+	results := make([]*BrokenLink, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < getEnvInt("LINK_CHECK_WORKERS", 8); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if result := checkLink(ctx, client, targets[i].URL, policy); result != nil {
+					result.ResourceType = targets[i].Type
+					results[i] = result
+				}
+				progress.linkChecked()
+			}
+		}()
+	}
+
+feed:
+	for i := range targets {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			// Stop checking as soon as the crawl is cancelled
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	var brokenLinks []BrokenLink
+	for _, result := range results {
+		if result != nil {
+			result.URLID = run.URLID
+			result.RunID = run.ID
+			result.PageURL = baseURL
+			brokenLinks = append(brokenLinks, *result)
 		}
+	}
 
-		resp, err := client.Head(fullURL)
-		if err != nil {
-			continue
+	if len(brokenLinks) > 0 {
+		db.Create(&brokenLinks)
+	}
+
+	return brokenLinks
+}
+
+// countBrokenLinks splits broken links into navigation links and assets by type
+func countBrokenLinks(analysis *PageAnalysis, brokenLinks []BrokenLink) {
+	analysis.InaccessibleLinks = 0
+	analysis.BrokenImages = 0
+	analysis.BrokenScripts = 0
+	analysis.BrokenStylesheets = 0
+	analysis.BrokenIframes = 0
+	analysis.BrokenMedia = 0
+
+	for _, link := range brokenLinks {
+		switch link.ResourceType {
+		case "image":
+			analysis.BrokenImages++
+		case "script":
+			analysis.BrokenScripts++
+		case "stylesheet":
+			analysis.BrokenStylesheets++
+		case "iframe":
+			analysis.BrokenIframes++
+		case "media":
+			analysis.BrokenMedia++
+		default:
+			analysis.InaccessibleLinks++
 		}
+	}
+}
+
+// checkLink returns a BrokenLink if the target answers with an error status
+// or cannot be reached at all.
+func checkLink(ctx context.Context, client *http.Client, linkURL string, policy *crawlPolicy) *BrokenLink {
+	resp, err := requestLink(ctx, client, http.MethodHead, linkURL, policy)
+	if err == nil && (resp.StatusCode == http.StatusForbidden ||
+		resp.StatusCode == http.StatusMethodNotAllowed ||
+		resp.StatusCode == http.StatusNotImplemented) {
+		// Many servers reject HEAD - retry with GET before reporting the link
+		resp.Body.Close()
+		resp, err = requestLink(ctx, client, http.MethodGet, linkURL, policy)
+	}
 
-		if resp.StatusCode >= 400 {
-			brokenLink := BrokenLink{
-				URLID:      urlID,
-				LinkURL:    fullURL,
-				StatusCode: resp.StatusCode,
+	if err != nil {
+		// Links disallowed by robots.txt or pointing to non-public
+		// addresses are skipped rather than reported
+		var blockedErr *blockedAddressError
+		if ctx.Err() != nil || errors.Is(err, errBlockedByRobots) || errors.As(err, &blockedErr) {
+			return nil
+		}
+		// A host failing its robots.txt request is down, not disallowing us
+		var robotsErr *robotsServerError
+		if errors.As(err, &robotsErr) {
+			return &BrokenLink{
+				LinkURL:    linkURL,
+				StatusCode: robotsErr.StatusCode,
 			}
-			brokenLinks = append(brokenLinks, brokenLink)
-			db.Create(&brokenLink)
-			count++
+		}
+		return &BrokenLink{
+			LinkURL:      linkURL,
+			ErrorKind:    linkErrorKind(err),
+			ErrorMessage: err.Error(),
 		}
 	}
+	resp.Body.Close()
 
-	return brokenLinks
+	if resp.StatusCode >= 400 {
+		return &BrokenLink{
+			LinkURL:    linkURL,
+			StatusCode: resp.StatusCode,
+		}
+	}
+
+	return nil
 }
 
-func collectLinks(n *html.Node, links *[]string) {
-	if n.Type == html.ElementNode && n.Data == "a" {
-		for _, attr := range n.Attr {
-			if attr.Key == "href" {
-				*links = append(*links, attr.Val)
+func requestLink(ctx context.Context, client *http.Client, method, linkURL string, policy *crawlPolicy) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, linkURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return doCrawlRequest(ctx, client, req, policy)
+}
+
+// linkErrorKind classifies network failures: dns, timeout, tls, refused or other
+func linkErrorKind(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return "timeout"
+		}
+		return "dns"
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return "timeout"
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return "refused"
+	}
+
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &certErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) ||
+		strings.Contains(err.Error(), "tls:") {
+		return "tls"
+	}
+
+	return "other"
+}
+
+// linkRef is a URL referenced by a page and the kind of resource it points to
+type linkRef struct {
+	URL  string
+	Type string // link, image, script, stylesheet, iframe, media
+}
+
+func collectLinks(n *html.Node, links *[]linkRef) {
+	if n.Type == html.ElementNode {
+		add := func(val, resourceType string) {
+			*links = append(*links, linkRef{URL: strings.TrimSpace(val), Type: resourceType})
+		}
+
+		switch n.Data {
+		case "a":
+			if href, ok := getAttr(n, "href"); ok {
+				add(href, "link")
+			}
+		case "img":
+			if src, ok := getAttr(n, "src"); ok {
+				add(src, "image")
+			}
+			for _, src := range srcsetURLs(n) {
+				add(src, "image")
+			}
+		case "script":
+			if src, ok := getAttr(n, "src"); ok {
+				add(src, "script")
+			}
+		case "link":
+			rel, _ := getAttr(n, "rel")
+			if href, ok := getAttr(n, "href"); ok && hasToken(rel, "stylesheet") {
+				add(href, "stylesheet")
+			}
+		case "iframe":
+			if src, ok := getAttr(n, "src"); ok {
+				add(src, "iframe")
+			}
+		case "video", "audio":
+			if src, ok := getAttr(n, "src"); ok {
+				add(src, "media")
+			}
+			if poster, ok := getAttr(n, "poster"); ok {
+				add(poster, "image")
+			}
+		case "source":
+			// <source src> belongs to video/audio, <source srcset> to picture
+			if src, ok := getAttr(n, "src"); ok {
+				add(src, "media")
+			}
+			for _, src := range srcsetURLs(n) {
+				add(src, "image")
 			}
 		}
 	}
@@ -513,6 +988,41 @@ func collectLinks(n *html.Node, links *[]string) {
 	}
 }
 
+func getAttr(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// hasToken reports whether a space separated attribute such as rel contains token
+func hasToken(value, token string) bool {
+	for _, field := range strings.Fields(value) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// srcsetURLs extracts the URLs from "a.png 1x, b.png 2x"
+func srcsetURLs(n *html.Node) []string {
+	srcset, ok := getAttr(n, "srcset")
+	if !ok {
+		return nil
+	}
+
+	var urls []string
+	for _, candidate := range strings.Split(srcset, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
+
 func resolveURL(href, baseURL string) string {
 	if strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") {
 		return href
@@ -532,6 +1042,15 @@ func resolveURL(href, baseURL string) string {
 }
 
 // API Handlers
+
+// ownedURLs scopes URL queries to the authenticated user's own URLs and
+// those in projects of their organisations
+func ownedURLs(c *gin.Context) *gorm.DB {
+	userID := c.GetUint("user_id")
+	projects := db.Model(&Project{}).Select("id").Where("organization_id IN (?)", memberOrganizationIDs(userID))
+	return db.Where("user_id = ? OR project_id IN (?)", userID, projects)
+}
+
 func addURL(c *gin.Context) {
 	var req CrawlRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -539,26 +1058,143 @@ func addURL(c *gin.Context) {
 		return
 	}
 
+	normalized, err := normalizeURL(req.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.URL = normalized
+
+	// Validate site crawl patterns up front so the crawler never sees a bad regex
+	for _, pattern := range []string{req.Include, req.Exclude} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path pattern: " + err.Error()})
+			return
+		}
+	}
+
 	if db == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
 		return
 	}
 
-	// Create URL record (queued status)
+	// URLs can only be filed under projects of the user's organisations
+	if req.ProjectID != nil {
+		var project Project
+		if err := accessibleProjects(c).First(&project, *req.ProjectID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return
+		}
+	}
+
+	// Create URL record (pending until a crawl is started)
 	urlRecord := URL{
-		URL:    req.URL,
-		Status: "queued",
-		Title:  "Untitled",
+		UserID:         c.GetUint("user_id"),
+		ProjectID:      req.ProjectID,
+		URL:            req.URL,
+		Status:         "pending",
+		CrawlMode:      "page",
+		Scope:          "host",
+		MaxDepth:       defaultSiteMaxDepth,
+		MaxPages:       req.MaxPages,
+		IncludePattern: req.Include,
+		ExcludePattern: req.Exclude,
+		IgnoreRobots:   req.IgnoreRobots,
+		AllowNoindex:   req.AllowNoindex,
+		RateLimit:      req.RateLimit,
+		MaxHostConns:   req.MaxHostConns,
+		PageAnalysis:   PageAnalysis{Title: "Untitled"},
+	}
+	if req.MaxDepth != nil {
+		urlRecord.MaxDepth = *req.MaxDepth
+	}
+	if req.Mode != "" {
+		urlRecord.CrawlMode = req.Mode
+	}
+	if req.Scope != "" {
+		urlRecord.Scope = req.Scope
 	}
 
-	if err := db.Create(&urlRecord).Error; err != nil {
+	created, err := createOrFindURL(&urlRecord)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save URL"})
 		return
 	}
 
+	// Submitting a URL that is already tracked returns the existing record
+	if !created {
+		c.JSON(http.StatusOK, urlRecord)
+		return
+	}
+
 	c.JSON(http.StatusCreated, urlRecord)
 }
 
+// createOrFindURL saves a new URL unless its owner already tracks it, in
+// which case urlRecord is replaced with the existing record
+func createOrFindURL(urlRecord *URL) (bool, error) {
+	var existing URL
+	err := db.Where("user_id = ? AND url = ?", urlRecord.UserID, urlRecord.URL).First(&existing).Error
+	if err == nil {
+		*urlRecord = existing
+		return false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	if err := db.Create(urlRecord).Error; err != nil {
+		// Lost a race with a concurrent submission of the same URL
+		if db.Where("user_id = ? AND url = ?", urlRecord.UserID, urlRecord.URL).First(&existing).Error == nil {
+			*urlRecord = existing
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// filteredURLs applies the search, status and project filters of a list request
+func filteredURLs(c *gin.Context, req *PaginationRequest) *gorm.DB {
+	query := ownedURLs(c).Model(&URL{})
+
+	// Add search filter
+	if req.Search != "" {
+		query = query.Where("url LIKE ? OR title LIKE ?", "%"+req.Search+"%", "%"+req.Search+"%")
+	}
+
+	// Add status filter
+	if req.Filter != "" && req.Filter != "all" {
+		query = query.Where("status = ?", req.Filter)
+	}
+
+	// Add project filter
+	if req.Project > 0 {
+		query = query.Where("project_id = ?", req.Project)
+	}
+
+	return query
+}
+
+// urlOrder returns the ORDER BY clause of a list request. Unknown columns
+// fall back to created_at so the sort can't inject SQL.
+func urlOrder(req *PaginationRequest) string {
+	column := "created_at"
+	stmt := &gorm.Statement{DB: db}
+	if req.Sort != "" && stmt.Parse(&URL{}) == nil {
+		if field := stmt.Schema.LookUpField(req.Sort); field != nil && field.DBName != "" {
+			column = field.DBName
+		}
+	}
+
+	order := "desc"
+	if strings.EqualFold(req.Order, "asc") {
+		order = "asc"
+	}
+
+	return column + " " + order
+}
+
 func getURLs(c *gin.Context) {
 	if db == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
@@ -579,33 +1215,16 @@ func getURLs(c *gin.Context) {
 	if req.PageSize <= 0 {
 		req.PageSize = 10
 	}
-	if req.Sort == "" {
-		req.Sort = "created_at"
-	}
-	if req.Order == "" {
-		req.Order = "desc"
-	}
 
 	// Build query
-	query := db.Model(&URL{})
-
-	// Add search filter
-	if req.Search != "" {
-		query = query.Where("url LIKE ? OR title LIKE ?", "%"+req.Search+"%", "%"+req.Search+"%")
-	}
-
-	// Add status filter
-	if req.Filter != "" && req.Filter != "all" {
-		query = query.Where("status = ?", req.Filter)
-	}
+	query := filteredURLs(c, &req)
 
 	// Count total
 	var total int64
 	query.Count(&total)
 
 	// Add sorting
-	orderBy := req.Sort + " " + req.Order
-	query = query.Order(orderBy)
+	query = query.Order(urlOrder(&req))
 
 	// Add pagination
 	offset := (req.Page - 1) * req.PageSize
@@ -646,17 +1265,27 @@ func getURLDetails(c *gin.Context) {
 	}
 
 	var urlRecord URL
-	if err := db.First(&urlRecord, id).Error; err != nil {
+	if err := ownedURLs(c).First(&urlRecord, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
 		return
 	}
 
-	var brokenLinks []BrokenLink
-	db.Where("url_id = ?", id).Find(&brokenLinks)
+	// Show the results of the latest run
+	var runID uint
+	if urlRecord.LatestRunID != nil {
+		runID = *urlRecord.LatestRunID
+	}
+	results := loadRunResults(urlRecord.ID, runID, urlRecord.CrawlMode == "site")
 
 	response := URLDetailResponse{
-		URL:         urlRecord,
-		BrokenLinks: brokenLinks,
+		URL:            urlRecord,
+		BrokenLinks:    results.BrokenLinks,
+		BrokenAssets:   results.BrokenAssets,
+		Pages:          results.Pages,
+		Site:           results.Site,
+		Meta:           results.Meta,
+		StructuredData: results.StructuredData,
+		Accessibility:  results.Accessibility,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -676,26 +1305,40 @@ func startCrawling(c *gin.Context) {
 	}
 
 	var urlRecord URL
-	if err := db.First(&urlRecord, id).Error; err != nil {
+	if err := ownedURLs(c).First(&urlRecord, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
 		return
 	}
 
-	// Start crawling in background
-	go func() {
-		_, _, err := crawlURL(urlRecord.URL)
-		if err != nil {
-			log.Printf("Crawling failed for URL %s: %v", urlRecord.URL, err)
-		}
-	}()
+	// Hand the URL to the worker pool
+	result := db.Model(&URL{}).
+		Where("id = ? AND status NOT IN ?", urlRecord.ID, []string{"queued", "running"}).
+		Update("status", "queued")
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue URL"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Crawling already queued or in progress"})
+		return
+	}
+	queue.notify()
+
+	urlRecord.Status = "queued"
+	publishStatus(&urlRecord)
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Crawling started",
+		"message": "Crawling queued",
 		"url_id":  id,
 	})
 }
 
 func stopCrawling(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
@@ -703,8 +1346,40 @@ func stopCrawling(c *gin.Context) {
 		return
 	}
 
-	// In a real implementation, you would stop the crawling process here
-	// For now, just return success
+	var urlRecord URL
+	if err := ownedURLs(c).First(&urlRecord, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	switch urlRecord.Status {
+	case "queued":
+		// Not claimed yet - just take it out of the queue
+		result := db.Model(&URL{}).Where("id = ? AND status = ?", urlRecord.ID, "queued").Update("status", "stopped")
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update URL"})
+			return
+		}
+		if result.RowsAffected > 0 {
+			urlRecord.Status = "stopped"
+			publishStatus(&urlRecord)
+			break
+		}
+		fallthrough
+	case "running":
+		// Cancel the running crawl; crawlURL marks the record as stopped. If
+		// another replica owns the crawl, its heartbeat picks up the flag.
+		if !runningCrawls.cancel(urlRecord.ID) {
+			if err := db.Model(&URL{}).Where("id = ?", urlRecord.ID).Update("stop_requested", true).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update URL"})
+				return
+			}
+		}
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": "URL is not being crawled"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Crawling stop requested",
 		"url_id":  id,
@@ -723,20 +1398,44 @@ func bulkAction(c *gin.Context) {
 		return
 	}
 
+	// Only act on URLs owned by the caller
+	var urlIDs []uint
+	if err := ownedURLs(c).Model(&URL{}).Where("id IN ?", req.URLIDs).Pluck("id", &urlIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch URLs"})
+		return
+	}
+
 	switch req.Action {
 	case "delete":
-		if err := db.Where("id IN ?", req.URLIDs).Delete(&URL{}).Error; err != nil {
+		// No scope allows deleting with an API key
+		if c.GetUint("api_key_id") != 0 {
+			apiKeyForbidden(c)
+			return
+		}
+		if !hasRole(c, roleAdmin) {
+			forbidden(c, roleAdmin)
+			return
+		}
+		if err := deleteURLs(db, urlIDs); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete URLs"})
 			return
 		}
-		// Also delete related broken links
-		db.Where("url_id IN ?", req.URLIDs).Delete(&BrokenLink{})
 
 	case "rerun":
-		if err := db.Model(&URL{}).Where("id IN ?", req.URLIDs).Update("status", "queued").Error; err != nil {
+		if len(urlIDs) == 0 {
+			break
+		}
+		// Skip URLs that are already queued or running to avoid double crawls
+		if err := db.Model(&URL{}).
+			Where("id IN ? AND status NOT IN ?", urlIDs, []string{"queued", "running"}).
+			Update("status", "queued").Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update URLs"})
 			return
 		}
+		for range urlIDs {
+			queue.notify()
+		}
+		publishStatusOf(urlIDs)
 
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action"})
@@ -745,10 +1444,18 @@ func bulkAction(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": fmt.Sprintf("Bulk %s completed", req.Action),
+		"url_ids": urlIDs,
 	})
 }
 
 func main() {
+	// Refuse to start without signing keys rather than fall back to a known one
+	keys, err := loadSigningKeys()
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+	jwtKeys = keys
+
 	// Initialize Gin router
 	router := gin.Default()
 
@@ -756,12 +1463,15 @@ func main() {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:5173", "http://localhost:8081"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key"},
 		AllowCredentials: true,
 	}))
 
 	// Public routes
 	router.POST("/login", login)
+	router.POST("/register", register)
+	router.POST("/token/refresh", refreshToken)
+	router.POST("/logout", logout)
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
@@ -788,16 +1498,72 @@ func main() {
 		connectDB()
 	}()
 
+	// Start the crawl worker pool; workers wait until the database is ready
+	queue = newCrawlQueue(getEnvInt("CRAWL_WORKERS", 4))
+	queue.start()
+
+	// Queue URLs with a due schedule
+	go runScheduler()
+
+	// Live crawl events; EventSource can't send headers, so it may
+	// authenticate with a single-use ticket from /api/events/ticket instead
+	router.GET("/api/events", streamAuth(), requireRole(roleViewer), requireScope("read"), streamEvents)
+
 	// Protected API routes
 	api := router.Group("/api")
 	api.Use(authMiddleware())
 	{
-		api.POST("/urls", addURL)
-		api.GET("/urls", getURLs)
-		api.GET("/urls/:id", getURLDetails)
-		api.POST("/urls/:id/start", startCrawling)
-		api.POST("/urls/:id/stop", stopCrawling)
-		api.POST("/urls/bulk", bulkAction)
+		// Account settings need an interactive login
+		account := api.Group("/account", requireSession())
+		account.PUT("/password", changePassword)
+		account.POST("/api-keys", createAPIKey)
+		account.GET("/api-keys", listAPIKeys)
+		account.DELETE("/api-keys/:id", revokeAPIKey)
+
+		// Viewers can list and read results
+		viewer := api.Group("", requireRole(roleViewer), requireScope("read"))
+		viewer.GET("/urls", getURLs)
+		viewer.GET("/urls/export", exportURLs)
+		viewer.GET("/urls/:id", getURLDetails)
+		viewer.GET("/urls/:id/runs", getURLRuns)
+		viewer.GET("/urls/:id/runs/:runId", getURLRun)
+		viewer.GET("/urls/:id/diff", getURLDiff)
+		viewer.GET("/queue", getQueueStats)
+		viewer.POST("/events/ticket", createStreamTicket)
+		viewer.GET("/organizations", getOrganizations)
+		viewer.GET("/projects", getProjects)
+		viewer.GET("/projects/:id", getProject)
+
+		// Operators can start and stop crawls, also with a crawl-scoped API
+		// key. Bulk delete additionally requires admin and a session,
+		// checked in the handler.
+		crawl := api.Group("", requireRole(roleOperator), requireScope("crawl"))
+		crawl.POST("/urls/:id/start", startCrawling)
+		crawl.POST("/urls/:id/stop", stopCrawling)
+		crawl.POST("/urls/bulk", bulkAction)
+
+		// Operators can add URLs and manage schedules, organisations and webhooks
+		operator := api.Group("", requireRole(roleOperator), requireSession())
+		operator.POST("/urls", addURL)
+		operator.POST("/urls/import", importURLs)
+		operator.PUT("/urls/:id/schedule", setSchedule)
+		operator.DELETE("/urls/:id/schedule", deleteSchedule)
+		operator.POST("/urls/:id/schedule/pause", pauseSchedule)
+		operator.POST("/urls/:id/schedule/resume", resumeSchedule)
+		operator.POST("/organizations", createOrganization)
+		operator.POST("/organizations/:id/members", addOrganizationMember)
+		operator.POST("/organizations/:id/projects", createProject)
+		operator.POST("/webhooks", createWebhook)
+		operator.GET("/webhooks", getWebhooks)
+		operator.DELETE("/webhooks/:id", deleteWebhook)
+		operator.GET("/webhooks/:id/deliveries", getWebhookDeliveries)
+
+		// Admins manage users and inspect crawler internals
+		admin := api.Group("/admin", requireRole(roleAdmin), requireSession())
+		admin.GET("/users", listUsers)
+		admin.PUT("/users/:id/role", updateUserRole)
+		admin.DELETE("/users/:id", deleteUser)
+		admin.GET("/limiter", getLimiterStatus)
 	}
 
 	// Start server
@@ -808,7 +1574,7 @@ func main() {
 
 	log.Printf("Server starting on port %s", port)
 	log.Printf("Features: JWT Auth ✓, Database Models ✓, Full CRUD ✓, Web Crawling ✓")
-	log.Printf("Endpoints: /login, /health, /api/urls (GET, POST), /api/urls/:id (GET), /api/urls/:id/start, /api/urls/:id/stop, /api/urls/bulk")
+	log.Printf("Endpoints: /login, /register, /token/refresh, /logout, /health, /api/account/password, /api/account/api-keys, /api/urls (GET, POST), /api/urls/import, /api/urls/export, /api/urls/:id (GET), /api/urls/:id/start, /api/urls/:id/stop, /api/urls/:id/runs, /api/urls/:id/diff, /api/urls/:id/schedule, /api/urls/bulk, /api/events, /api/events/ticket, /api/organizations, /api/projects, /api/webhooks, /api/queue, /api/admin/users, /api/admin/limiter")
 	log.Printf("Note: Database connection will be established in background")
 	log.Fatal(router.Run(":" + port))
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testDBCount atomic.Int64
+
+// openTestDB points the global db at a fresh in-memory SQLite database for
+// the duration of a test
+func openTestDB(t *testing.T) {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:test%d?mode=memory&cache=shared", testDBCount.Add(1))
+	testDB, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.AutoMigrate(&URL{}, &BrokenLink{}, &CrawledPage{}, &CrawlRun{}, &User{}, &Session{}, &StreamTicket{}, &APIKey{}, &Organization{}, &OrganizationMember{}, &Project{}, &Webhook{}, &WebhookDelivery{}, &PageMeta{}, &StructuredData{}, &AccessibilityAudit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := db
+	db = testDB
+	t.Cleanup(func() {
+		db = previous
+		if sqlDB, err := testDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// maxURLLength matches the size of the urls.url column
+const maxURLLength = 191
+
+// normalizeURL validates a submitted URL and rewrites it to a canonical form
+// so the same page isn't tracked twice: https is assumed when the scheme is
+// missing, the scheme and host are lowercased, dot segments are resolved,
+// default ports, fragments and trailing slashes are dropped and query
+// parameters are sorted.
+func normalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errors.New("URL is empty")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + strings.TrimPrefix(raw, "//")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q, use http or https", u.Scheme)
+	}
+	if u.User != nil {
+		return "", errors.New("URLs with credentials are not supported")
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "", errors.New("URL has no host")
+	}
+	if net.ParseIP(host) == nil {
+		// Internationalised domain names are stored in their ASCII form
+		host, err = idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", fmt.Errorf("invalid host: %w", err)
+		}
+		if !strings.Contains(host, ".") && host != "localhost" {
+			return "", fmt.Errorf("invalid host %q", host)
+		}
+	}
+
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	// Resolving against an empty reference removes "." and ".." segments
+	u = u.ResolveReference(&url.URL{})
+
+	// The root is always "/"; other paths lose their trailing slash
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = strings.TrimRight(u.RawPath, "/")
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	}
+
+	u.RawQuery = sortQuery(u.RawQuery)
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	normalized := u.String()
+	if len(normalized) > maxURLLength {
+		return "", fmt.Errorf("URL is longer than %d characters", maxURLLength)
+	}
+	return normalized, nil
+}
+
+// sortQuery sorts the parameters of a raw query by key, keeping the order of
+// repeated keys. Pairs are left encoded as they were, so "?flag" stays
+// "?flag" rather than becoming "?flag=".
+func sortQuery(rawQuery string) string {
+	var pairs []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	key := func(pair string) string {
+		k, _, _ := strings.Cut(pair, "=")
+		return k
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return key(pairs[i]) < key(pairs[j])
+	})
+	return strings.Join(pairs, "&")
+}
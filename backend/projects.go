@@ -0,0 +1,327 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Organisations group users; their projects group URLs. Members of an
+// organisation share every URL filed under its projects.
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"size:191;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type OrganizationMember struct {
+	OrganizationID uint      `json:"organization_id" gorm:"primaryKey"`
+	UserID         uint      `json:"user_id" gorm:"primaryKey;index"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type Project struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrganizationID uint      `json:"organization_id" gorm:"uniqueIndex:idx_org_project;not null"`
+	Name           string    `json:"name" gorm:"size:191;uniqueIndex:idx_org_project;not null"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ProjectStats are totals over the latest run of every URL in a project
+type ProjectStats struct {
+	URLs               int `json:"urls"`
+	Done               int `json:"done"`
+	Errors             int `json:"errors"`
+	BrokenLinks        int `json:"broken_links"`
+	BrokenAssets       int `json:"broken_assets"`
+	PagesWithLoginForm int `json:"pages_with_login_form"`
+}
+
+type ProjectResponse struct {
+	Project
+	Stats ProjectStats `json:"stats"`
+}
+
+type OrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=191"`
+}
+
+type ProjectRequest struct {
+	Name string `json:"name" binding:"required,max=191"`
+}
+
+type AddMemberRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// memberOrganizationIDs is a subquery of the organisations a user belongs to
+func memberOrganizationIDs(userID uint) *gorm.DB {
+	return db.Model(&OrganizationMember{}).Select("organization_id").Where("user_id = ?", userID)
+}
+
+// accessibleProjects scopes project queries to the authenticated user's organisations
+func accessibleProjects(c *gin.Context) *gorm.DB {
+	return db.Where("organization_id IN (?)", memberOrganizationIDs(c.GetUint("user_id")))
+}
+
+// projectStats computes the aggregates of several projects at once
+func projectStats(projectIDs []uint) map[uint]*ProjectStats {
+	stats := make(map[uint]*ProjectStats)
+	for _, id := range projectIDs {
+		stats[id] = &ProjectStats{}
+	}
+	if len(projectIDs) == 0 {
+		return stats
+	}
+
+	var urlRows []struct {
+		ProjectID uint
+		URLs      int
+		Done      int
+		Errors    int
+	}
+	db.Model(&URL{}).
+		Select(`project_id, COUNT(*) AS urls,
+			COALESCE(SUM(CASE WHEN status = 'done' THEN 1 ELSE 0 END), 0) AS done,
+			COALESCE(SUM(CASE WHEN status = 'error' THEN 1 ELSE 0 END), 0) AS errors`).
+		Where("project_id IN ?", projectIDs).
+		Group("project_id").
+		Scan(&urlRows)
+	for _, row := range urlRows {
+		stats[row.ProjectID].URLs = row.URLs
+		stats[row.ProjectID].Done = row.Done
+		stats[row.ProjectID].Errors = row.Errors
+	}
+
+	// Broken links and pages are counted from each URL's latest run only
+	var linkRows []struct {
+		ProjectID    uint
+		BrokenLinks  int
+		BrokenAssets int
+	}
+	db.Table("broken_links").
+		Select(`urls.project_id,
+			COALESCE(SUM(CASE WHEN broken_links.resource_type = 'link' THEN 1 ELSE 0 END), 0) AS broken_links,
+			COALESCE(SUM(CASE WHEN broken_links.resource_type <> 'link' THEN 1 ELSE 0 END), 0) AS broken_assets`).
+		Joins("JOIN urls ON urls.id = broken_links.url_id AND urls.latest_run_id = broken_links.run_id").
+		Where("urls.project_id IN ?", projectIDs).
+		Group("urls.project_id").
+		Scan(&linkRows)
+	for _, row := range linkRows {
+		stats[row.ProjectID].BrokenLinks = row.BrokenLinks
+		stats[row.ProjectID].BrokenAssets = row.BrokenAssets
+	}
+
+	// Site crawls record every page; single-page crawls only have the URL row
+	var loginRows []struct {
+		ProjectID uint
+		Pages     int
+	}
+	db.Table("crawled_pages").
+		Select("urls.project_id, COUNT(*) AS pages").
+		Joins("JOIN urls ON urls.id = crawled_pages.url_id AND urls.latest_run_id = crawled_pages.run_id").
+		Where("urls.project_id IN ? AND crawled_pages.has_login_form", projectIDs).
+		Group("urls.project_id").
+		Scan(&loginRows)
+	for _, row := range loginRows {
+		stats[row.ProjectID].PagesWithLoginForm += row.Pages
+	}
+
+	loginRows = nil
+	db.Model(&URL{}).
+		Select("project_id, COUNT(*) AS pages").
+		Where("project_id IN ? AND crawl_mode <> ? AND has_login_form", projectIDs, "site").
+		Group("project_id").
+		Scan(&loginRows)
+	for _, row := range loginRows {
+		stats[row.ProjectID].PagesWithLoginForm += row.Pages
+	}
+
+	return stats
+}
+
+// loadMemberOrganization loads an organisation the authenticated user belongs to
+func loadMemberOrganization(c *gin.Context) (*Organization, bool) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return nil, false
+	}
+
+	var org Organization
+	if err := db.Where("id IN (?)", memberOrganizationIDs(c.GetUint("user_id"))).First(&org, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return nil, false
+	}
+
+	return &org, true
+}
+
+// API Handlers
+func createOrganization(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	// The creator is the first member
+	org := Organization{Name: req.Name}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{OrganizationID: org.ID, UserID: c.GetUint("user_id")}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+func getOrganizations(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	var orgs []Organization
+	if err := db.Where("id IN (?)", memberOrganizationIDs(c.GetUint("user_id"))).Order("name").Find(&orgs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organizations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orgs)
+}
+
+func addOrganizationMember(c *gin.Context) {
+	var req AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, ok := loadMemberOrganization(c)
+	if !ok {
+		return
+	}
+
+	var user User
+	if err := db.Where("username = ?", req.Username).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var count int64
+	db.Model(&OrganizationMember{}).Where("organization_id = ? AND user_id = ?", org.ID, user.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member"})
+		return
+	}
+
+	member := OrganizationMember{OrganizationID: org.ID, UserID: user.ID}
+	if err := db.Create(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+func createProject(c *gin.Context) {
+	var req ProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, ok := loadMemberOrganization(c)
+	if !ok {
+		return
+	}
+
+	var count int64
+	db.Model(&Project{}).Where("organization_id = ? AND name = ?", org.ID, req.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Project already exists"})
+		return
+	}
+
+	project := Project{OrganizationID: org.ID, Name: req.Name}
+	if err := db.Create(&project).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, project)
+}
+
+func getProjects(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	query := accessibleProjects(c)
+	if orgID := c.Query("organization_id"); orgID != "" {
+		query = query.Where("organization_id = ?", orgID)
+	}
+
+	var projects []Project
+	if err := query.Order("name").Find(&projects).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
+		return
+	}
+
+	ids := make([]uint, len(projects))
+	for i, project := range projects {
+		ids[i] = project.ID
+	}
+	stats := projectStats(ids)
+
+	response := make([]ProjectResponse, len(projects))
+	for i, project := range projects {
+		response[i] = ProjectResponse{Project: project, Stats: *stats[project.ID]}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func getProject(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	var project Project
+	if err := accessibleProjects(c).First(&project, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	stats := projectStats([]uint{project.ID})
+	c.JSON(http.StatusOK, ProjectResponse{Project: project, Stats: *stats[project.ID]})
+}
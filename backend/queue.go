@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Queue bookkeeping columns are owned by the worker that claimed a URL and
+// must not be overwritten when the crawler saves its results.
+var queueColumns = []string{"claimed_by", "heartbeat_at", "stop_requested"}
+
+// Crawl queue - a bounded pool of workers claiming queued URL rows from MySQL
+type crawlQueue struct {
+	instanceID        string
+	workers           int
+	busy              int32
+	wake              chan struct{}
+	pollInterval      time.Duration
+	heartbeatInterval time.Duration
+	staleAfter        time.Duration
+}
+
+var queue *crawlQueue
+
+type QueueStatsResponse struct {
+	InstanceID  string  `json:"instance_id"`
+	Depth       int64   `json:"depth"`
+	Running     int64   `json:"running"`
+	Workers     int     `json:"workers"`
+	BusyWorkers int     `json:"busy_workers"`
+	Utilization float64 `json:"utilization"`
+}
+
+func newCrawlQueue(workers int) *crawlQueue {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	// Hostname and PID stay the same when a container restarts, which lets a
+	// restarted replica recognise the rows it claimed before going down
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "backend"
+	}
+
+	return &crawlQueue{
+		instanceID:        fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		workers:           workers,
+		wake:              make(chan struct{}, workers),
+		pollInterval:      time.Duration(getEnvInt("CRAWL_POLL_SECONDS", 5)) * time.Second,
+		heartbeatInterval: 15 * time.Second,
+		staleAfter:        2 * time.Minute,
+	}
+}
+
+// start launches the worker pool and the recovery loop
+func (q *crawlQueue) start() {
+	log.Printf("Starting crawl queue %s with %d workers", q.instanceID, q.workers)
+
+	go q.recoverLoop()
+	for i := 0; i < q.workers; i++ {
+		go q.worker(i + 1)
+	}
+}
+
+// notify wakes an idle worker so newly queued URLs are picked up immediately
+func (q *crawlQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *crawlQueue) worker(n int) {
+	for {
+		if db == nil {
+			time.Sleep(q.pollInterval)
+			continue
+		}
+
+		urlRecord, err := q.claim()
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Worker %d failed to claim URL: %v", n, err)
+			}
+
+			select {
+			case <-q.wake:
+			case <-time.After(q.pollInterval):
+			}
+			continue
+		}
+
+		atomic.AddInt32(&q.busy, 1)
+		q.process(n, urlRecord)
+		atomic.AddInt32(&q.busy, -1)
+	}
+}
+
+// claim locks the oldest queued URL and marks it as running for this
+// instance. SKIP LOCKED keeps replicas from waiting on or double-claiming the
+// same row.
+func (q *crawlQueue) claim() (*URL, error) {
+	var urlRecord URL
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", "queued").
+			Order("updated_at").
+			First(&urlRecord).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(&urlRecord).Updates(map[string]interface{}{
+			"status":         "running",
+			"claimed_by":     q.instanceID,
+			"heartbeat_at":   now,
+			"stop_requested": false,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &urlRecord, nil
+}
+
+func (q *crawlQueue) process(n int, urlRecord *URL) {
+	ctx, ok := runningCrawls.register(urlRecord.ID)
+	if !ok {
+		log.Printf("Worker %d: URL %d is already being crawled", n, urlRecord.ID)
+		return
+	}
+	defer runningCrawls.finish(urlRecord.ID)
+
+	done := make(chan struct{})
+	go q.heartbeat(urlRecord.ID, done)
+
+	log.Printf("Worker %d claimed URL %s (ID: %d)", n, urlRecord.URL, urlRecord.ID)
+
+	_, _, err := crawlURL(ctx, urlRecord.ID)
+	close(done)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("Crawling failed for URL %s: %v", urlRecord.URL, err)
+	}
+
+	// Release the claim
+	db.Model(&URL{}).Where("id = ? AND claimed_by = ?", urlRecord.ID, q.instanceID).Updates(map[string]interface{}{
+		"claimed_by":     "",
+		"heartbeat_at":   nil,
+		"stop_requested": false,
+	})
+}
+
+// heartbeat keeps the claim alive and relays stop requests made through
+// other replicas to the local crawl.
+func (q *crawlQueue) heartbeat(urlID uint, done <-chan struct{}) {
+	ticker := time.NewTicker(q.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			db.Model(&URL{}).Where("id = ? AND claimed_by = ?", urlID, q.instanceID).Update("heartbeat_at", time.Now())
+
+			var urlRecord URL
+			if err := db.Select("id", "stop_requested").First(&urlRecord, urlID).Error; err == nil && urlRecord.StopRequested {
+				runningCrawls.cancel(urlID)
+			}
+		}
+	}
+}
+
+// recoverLoop puts rows stuck in "running" back in the queue. On startup it
+// immediately re-queues the rows this instance owned before a restart; after
+// that it re-queues rows whose owner stopped sending heartbeats.
+func (q *crawlQueue) recoverLoop() {
+	recoveredOwn := false
+
+	ticker := time.NewTicker(q.heartbeatInterval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		if db == nil {
+			continue
+		}
+
+		if !recoveredOwn {
+			requeued, err := q.recoverOwn()
+			if err == nil {
+				recoveredOwn = true
+				if requeued > 0 {
+					log.Printf("Re-queued %d URLs left running by a previous run of this instance", requeued)
+					q.notify()
+				}
+			}
+		}
+
+		if requeued, err := q.recoverStale(); err == nil && requeued > 0 {
+			log.Printf("Re-queued %d stale running URLs", requeued)
+			q.notify()
+		}
+	}
+}
+
+// recoverOwn re-queues the running rows claimed by this instance
+func (q *crawlQueue) recoverOwn() (int64, error) {
+	result := db.Model(&URL{}).
+		Where("status = ? AND claimed_by = ?", "running", q.instanceID).
+		Updates(map[string]interface{}{"status": "queued", "claimed_by": "", "heartbeat_at": nil})
+	return result.RowsAffected, result.Error
+}
+
+// recoverStale re-queues running rows without a heartbeat for staleAfter
+func (q *crawlQueue) recoverStale() (int64, error) {
+	result := db.Model(&URL{}).
+		Where("status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", "running", time.Now().Add(-q.staleAfter)).
+		Updates(map[string]interface{}{"status": "queued", "claimed_by": "", "heartbeat_at": nil})
+	return result.RowsAffected, result.Error
+}
+
+// migrateQueuedURLs runs once when the queue columns are added. URLs used to
+// be created as "queued" and would all be crawled once the workers start, so
+// the ones that never ran are moved to "pending".
+func migrateQueuedURLs() {
+	result := db.Model(&URL{}).Where("status = ? AND latest_run_id IS NULL", "queued").Update("status", "pending")
+	if result.Error != nil {
+		log.Printf("Failed to migrate queued URLs: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Moved %d never-crawled queued URLs to pending", result.RowsAffected)
+	}
+}
+
+func (q *crawlQueue) stats() (QueueStatsResponse, error) {
+	stats := QueueStatsResponse{
+		InstanceID:  q.instanceID,
+		Workers:     q.workers,
+		BusyWorkers: int(atomic.LoadInt32(&q.busy)),
+	}
+	stats.Utilization = float64(stats.BusyWorkers) / float64(stats.Workers)
+
+	if err := db.Model(&URL{}).Where("status = ?", "queued").Count(&stats.Depth).Error; err != nil {
+		return stats, err
+	}
+	if err := db.Model(&URL{}).Where("status = ?", "running").Count(&stats.Running).Error; err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// API Handlers
+func getQueueStats(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	stats, err := queue.stats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch queue stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestCrawlQueueClaim(t *testing.T) {
+	openTestDB(t)
+	q := &crawlQueue{instanceID: "test-1"}
+
+	now := time.Now()
+	runID := uint(9)
+	db.Create(&URL{ID: 1, URL: "https://example.com/newer", Status: "queued", UpdatedAt: now})
+	db.Create(&URL{ID: 2, URL: "https://example.com/older", Status: "queued", UpdatedAt: now.Add(-time.Hour), LatestRunID: &runID, StopRequested: true})
+	db.Create(&URL{ID: 3, URL: "https://example.com/pending", Status: "pending", UpdatedAt: now.Add(-2 * time.Hour)})
+	db.Create(&URL{ID: 4, URL: "https://example.com/running", Status: "running", UpdatedAt: now.Add(-2 * time.Hour)})
+
+	// The longest waiting URL comes first
+	for _, want := range []uint{2, 1} {
+		claimed, err := q.claim()
+		if err != nil {
+			t.Fatalf("claim: %v", err)
+		}
+		if claimed.ID != want {
+			t.Fatalf("claimed URL %d, want %d", claimed.ID, want)
+		}
+
+		var row URL
+		db.First(&row, want)
+		if row.Status != "running" || row.ClaimedBy != q.instanceID || row.HeartbeatAt == nil || row.StopRequested {
+			t.Errorf("claimed row = status %q, claimed by %q, heartbeat %v, stop %v", row.Status, row.ClaimedBy, row.HeartbeatAt, row.StopRequested)
+		}
+	}
+
+	if _, err := q.claim(); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("claim on an empty queue: error %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestCrawlQueueHeartbeat(t *testing.T) {
+	openTestDB(t)
+	q := &crawlQueue{instanceID: "test-1", heartbeatInterval: 10 * time.Millisecond}
+
+	old := time.Now().Add(-time.Hour)
+	db.Create(&URL{ID: 1, URL: "https://example.com/", Status: "running", ClaimedBy: q.instanceID, HeartbeatAt: &old})
+
+	ctx, ok := runningCrawls.register(1)
+	if !ok {
+		t.Fatal("URL 1 is already registered")
+	}
+	defer runningCrawls.finish(1)
+
+	done := make(chan struct{})
+	defer close(done)
+	go q.heartbeat(1, done)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		var row URL
+		db.First(&row, 1)
+		if row.HeartbeatAt != nil && row.HeartbeatAt.After(old) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("heartbeat_at was not refreshed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// A stop requested through another replica cancels the local crawl
+	db.Model(&URL{}).Where("id = ?", 1).Update("stop_requested", true)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stop request was not relayed to the crawl")
+	}
+}
+
+func TestCrawlQueueRecovery(t *testing.T) {
+	openTestDB(t)
+	q := &crawlQueue{instanceID: "test-1", staleAfter: 2 * time.Minute}
+
+	fresh := time.Now()
+	stale := time.Now().Add(-10 * time.Minute)
+	db.Create(&URL{ID: 1, URL: "https://example.com/own", Status: "running", ClaimedBy: q.instanceID, HeartbeatAt: &fresh})
+	db.Create(&URL{ID: 2, URL: "https://example.com/alive", Status: "running", ClaimedBy: "test-2", HeartbeatAt: &fresh})
+	db.Create(&URL{ID: 3, URL: "https://example.com/stale", Status: "running", ClaimedBy: "test-2", HeartbeatAt: &stale})
+	db.Create(&URL{ID: 4, URL: "https://example.com/no-heartbeat", Status: "running", ClaimedBy: "test-3"})
+	db.Create(&URL{ID: 5, URL: "https://example.com/done", Status: "done", HeartbeatAt: &stale})
+
+	// After a restart the instance takes back its own rows at once
+	if requeued, err := q.recoverOwn(); err != nil || requeued != 1 {
+		t.Fatalf("recoverOwn = %d, %v, want 1", requeued, err)
+	}
+	if requeued, err := q.recoverStale(); err != nil || requeued != 2 {
+		t.Fatalf("recoverStale = %d, %v, want 2", requeued, err)
+	}
+
+	want := map[uint]string{1: "queued", 2: "running", 3: "queued", 4: "queued", 5: "done"}
+	var rows []URL
+	db.Order("id").Find(&rows)
+	for _, row := range rows {
+		if row.Status != want[row.ID] {
+			t.Errorf("URL %d status %q, want %q", row.ID, row.Status, want[row.ID])
+		}
+		if row.Status == "queued" && (row.ClaimedBy != "" || row.HeartbeatAt != nil) {
+			t.Errorf("URL %d re-queued with claim %q and heartbeat %v", row.ID, row.ClaimedBy, row.HeartbeatAt)
+		}
+	}
+}
+
+func TestMigrateQueuedURLs(t *testing.T) {
+	openTestDB(t)
+
+	runID := uint(3)
+	db.Create(&URL{ID: 1, URL: "https://example.com/never-crawled", Status: "queued"})
+	db.Create(&URL{ID: 2, URL: "https://example.com/rerun", Status: "queued", LatestRunID: &runID})
+	db.Create(&URL{ID: 3, URL: "https://example.com/done", Status: "done"})
+
+	migrateQueuedURLs()
+
+	want := map[uint]string{1: "pending", 2: "queued", 3: "done"}
+	var rows []URL
+	db.Find(&rows)
+	for _, row := range rows {
+		if row.Status != want[row.ID] {
+			t.Errorf("URL %d status %q, want %q", row.ID, row.Status, want[row.ID])
+		}
+	}
+}
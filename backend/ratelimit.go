@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Per-host politeness - a token bucket plus a cap on concurrent requests,
+// shared by every goroutine that talks to a crawled host
+const hostStateIdleTTL = 10 * time.Minute
+
+type hostLimiter struct {
+	mu       sync.Mutex
+	hosts    map[string]*hostState
+	rate     float64
+	burst    int
+	maxConns int
+}
+
+type hostState struct {
+	tokens    float64
+	last      time.Time
+	lastStart time.Time // when the last request was let through
+	active    int
+	waiting   int
+	released  chan struct{} // closed and replaced whenever a slot frees up
+}
+
+type HostLimiterState struct {
+	Host     string    `json:"host"`
+	Tokens   float64   `json:"tokens"`
+	Active   int       `json:"active"`
+	Waiting  int       `json:"waiting"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+type LimiterStatusResponse struct {
+	Rate     float64            `json:"rate"`
+	Burst    int                `json:"burst"`
+	MaxConns int                `json:"max_conns"`
+	Hosts    []HostLimiterState `json:"hosts"`
+}
+
+var limiter = newHostLimiter(
+	getEnvFloat("HOST_RATE_LIMIT", 2),
+	getEnvInt("HOST_BURST", 4),
+	getEnvInt("HOST_MAX_CONNS", 2),
+)
+
+func newHostLimiter(rate float64, burst, maxConns int) *hostLimiter {
+	if rate <= 0 {
+		rate = 1
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	if maxConns <= 0 {
+		maxConns = 1
+	}
+
+	return &hostLimiter{
+		hosts:    make(map[string]*hostState),
+		rate:     rate,
+		burst:    burst,
+		maxConns: maxConns,
+	}
+}
+
+// acquire blocks until the host has both a free connection slot and a
+// token. Zero rate or maxConns fall back to the global settings. A
+// non-zero delay, from a robots.txt Crawl-delay, allows one request at a
+// time with at least delay between their starts, whatever the bucket
+// holds. The returned function must be called once the request is finished.
+func (l *hostLimiter) acquire(ctx context.Context, host string, rate float64, maxConns int, delay time.Duration) (func(), error) {
+	if rate <= 0 {
+		rate = l.rate
+	}
+	if maxConns <= 0 {
+		maxConns = l.maxConns
+	}
+	if delay > 0 {
+		maxConns = 1
+	}
+
+	l.mu.Lock()
+	st := l.state(host)
+	st.waiting++
+	defer func() {
+		l.mu.Lock()
+		st.waiting--
+		l.mu.Unlock()
+	}()
+
+	for {
+		now := time.Now()
+		st.tokens += now.Sub(st.last).Seconds() * rate
+		if st.tokens > float64(l.burst) {
+			st.tokens = float64(l.burst)
+		}
+		st.last = now
+
+		var timer *time.Timer
+		var wait <-chan time.Time
+		released := st.released
+
+		switch {
+		case st.active >= maxConns:
+			// Wait for a running request to finish
+		case delay > 0 && now.Sub(st.lastStart) < delay:
+			timer = time.NewTimer(delay - now.Sub(st.lastStart))
+			wait = timer.C
+		case st.tokens >= 1:
+			st.tokens--
+			st.active++
+			st.lastStart = now
+			l.mu.Unlock()
+			return func() { l.release(st) }, nil
+		default:
+			delay := time.Duration((1 - st.tokens) / rate * float64(time.Second))
+			timer = time.NewTimer(delay)
+			wait = timer.C
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-released:
+		case <-wait:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		l.mu.Lock()
+	}
+}
+
+func (l *hostLimiter) release(st *hostState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	st.active--
+	close(st.released)
+	st.released = make(chan struct{})
+}
+
+// state returns the bucket for host, creating a full one if needed. Callers
+// must hold l.mu.
+func (l *hostLimiter) state(host string) *hostState {
+	st, exists := l.hosts[host]
+	if exists {
+		return st
+	}
+
+	// Forget idle hosts so the map doesn't grow without bound
+	for key, old := range l.hosts {
+		if old.active == 0 && old.waiting == 0 && time.Since(old.last) > hostStateIdleTTL {
+			delete(l.hosts, key)
+		}
+	}
+
+	st = &hostState{
+		tokens:   float64(l.burst),
+		last:     time.Now(),
+		released: make(chan struct{}),
+	}
+	l.hosts[host] = st
+	return st
+}
+
+func (l *hostLimiter) status() LimiterStatusResponse {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	response := LimiterStatusResponse{
+		Rate:     l.rate,
+		Burst:    l.burst,
+		MaxConns: l.maxConns,
+		Hosts:    []HostLimiterState{},
+	}
+
+	for host, st := range l.hosts {
+		response.Hosts = append(response.Hosts, HostLimiterState{
+			Host:     host,
+			Tokens:   st.tokens,
+			Active:   st.active,
+			Waiting:  st.waiting,
+			LastUsed: st.last,
+		})
+	}
+	sort.Slice(response.Hosts, func(i, j int) bool {
+		return response.Hosts[i].Host < response.Hosts[j].Host
+	})
+
+	return response
+}
+
+// releasingBody frees the host slot when the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// sendLimited performs a request once the host limiter allows it. The host
+// slot stays taken until the response body is closed.
+func sendLimited(ctx context.Context, client *http.Client, req *http.Request, rate float64, maxConns int, delay time.Duration) (*http.Response, error) {
+	release, err := limiter.acquire(ctx, strings.ToLower(req.URL.Hostname()), rate, maxConns, delay)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// API Handlers
+func getLimiterStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, limiter.status())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterCrawlDelay(t *testing.T) {
+	// A full bucket would let four requests through at once
+	l := newHostLimiter(100, 4, 2)
+	delay := 50 * time.Millisecond
+
+	var mu sync.Mutex
+	var starts []time.Time
+	active, maxActive := 0, 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.acquire(context.Background(), "example.com", 0, 0, delay)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			starts = append(starts, time.Now())
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			active--
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if maxActive != 1 {
+		t.Errorf("%d requests ran at once, want 1", maxActive)
+	}
+	for i := 1; i < len(starts); i++ {
+		// Allow for timer granularity
+		if gap := starts[i].Sub(starts[i-1]); gap < delay-5*time.Millisecond {
+			t.Errorf("request %d started %v after the previous one, want at least %v", i, gap, delay)
+		}
+	}
+}
+
+func TestHostLimiterBurst(t *testing.T) {
+	l := newHostLimiter(1, 3, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Without a crawl delay the bucket's burst is available immediately
+	for i := 0; i < 3; i++ {
+		release, err := l.acquire(ctx, "example.com", 0, 0, 0)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		defer release()
+	}
+
+	if _, err := l.acquire(ctx, "example.com", 0, 0, 0); err == nil {
+		t.Error("a fourth concurrent request should wait for a slot")
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Robots.txt handling
+const (
+	robotsCacheTTL = time.Hour
+	robotsRetryTTL = time.Minute // for unreachable robots.txt and server errors
+	robotsMaxSize  = 500 * 1024
+)
+
+var errBlockedByRobots = errors.New("Blocked by robots.txt")
+
+// robotsServerError means robots.txt answered with a 5xx. The site is
+// failing rather than disallowing us, so requests fail with its status.
+type robotsServerError struct {
+	StatusCode int
+}
+
+func (e *robotsServerError) Error() string {
+	return fmt.Sprintf("robots.txt returned HTTP %d", e.StatusCode)
+}
+
+// crawlerUserAgent is sent with every request and matched against robots.txt groups
+var crawlerUserAgent = func() string {
+	if ua := os.Getenv("CRAWLER_USER_AGENT"); ua != "" {
+		return ua
+	}
+	return "WebCrawlerBot/1.0"
+}()
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsRules is the group of a robots.txt file that applies to our user agent
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsEntry struct {
+	mu        sync.Mutex
+	rules     *robotsRules
+	err       error // robots.txt couldn't be fetched
+	expiresAt time.Time
+}
+
+type robotsCache struct {
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+var robots = &robotsCache{entries: make(map[string]*robotsEntry)}
+
+// rulesFor returns the cached rules for the scheme and host of target,
+// fetching robots.txt when the cache entry is missing or expired. An
+// unreachable or failing robots.txt is an error rather than permission to
+// crawl, and is retried after robotsRetryTTL.
+func (c *robotsCache) rulesFor(ctx context.Context, client *http.Client, target *url.URL, policy *crawlPolicy) (*robotsRules, error) {
+	key := target.Scheme + "://" + strings.ToLower(target.Host)
+
+	c.mu.Lock()
+	entry, exists := c.entries[key]
+	if !exists {
+		entry = &robotsEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	// Lock per host so concurrent requests share a single robots.txt fetch
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if (entry.rules == nil && entry.err == nil) || time.Now().After(entry.expiresAt) {
+		rules, err := fetchRobots(ctx, client, key+"/robots.txt", policy)
+		if err != nil {
+			// Don't cache failures caused by the crawl being cancelled
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Failed to fetch robots.txt for %s: %v", key, err)
+		}
+
+		entry.rules, entry.err = rules, err
+		entry.expiresAt = time.Now().Add(robotsCacheTTL)
+		if err != nil {
+			entry.expiresAt = time.Now().Add(robotsRetryTTL)
+		}
+	}
+
+	return entry.rules, entry.err
+}
+
+func fetchRobots(ctx context.Context, client *http.Client, robotsURL string, policy *crawlPolicy) (*robotsRules, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", crawlerUserAgent)
+
+	resp, err := followRedirects(ctx, req, maxRobotsRedirects, func(req *http.Request) (*http.Response, error) {
+		return sendLimited(ctx, client, req, policy.RateLimit, policy.MaxConns, 0)
+	})
+	if err != nil {
+		// Unreachable robots.txt - nothing may be crawled until it can be read
+		return nil, fmt.Errorf("robots.txt unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		// The site is unavailable; nothing is crawled until it recovers
+		return nil, &robotsServerError{StatusCode: resp.StatusCode}
+	case resp.StatusCode >= 400:
+		// No robots.txt - everything is allowed
+		return &robotsRules{}, nil
+	}
+
+	return parseRobots(io.LimitReader(resp.Body, robotsMaxSize), productToken(crawlerUserAgent)), nil
+}
+
+// productToken extracts "webcrawlerbot" from "WebCrawlerBot/1.0 (+info)"
+func productToken(userAgent string) string {
+	token := strings.Fields(userAgent + " ")[0]
+	if i := strings.Index(token, "/"); i >= 0 {
+		token = token[:i]
+	}
+	return strings.ToLower(token)
+}
+
+// parseRobots returns the rules of the most specific group matching agent,
+// falling back to the "*" group.
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	type group struct {
+		agents []string
+		rules  robotsRules
+	}
+
+	var groups []*group
+	var current *group
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines share the same group
+			if !inAgents {
+				current = &group{}
+				groups = append(groups, current)
+				inAgents = true
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inAgents = false
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules.rules = append(current.rules.rules, robotsRule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.rules.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	var matched, wildcard *group
+	matchedLen := 0
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if a == "*" {
+				if wildcard == nil {
+					wildcard = g
+				}
+			} else if strings.Contains(agent, a) && len(a) > matchedLen {
+				matched = g
+				matchedLen = len(a)
+			}
+		}
+	}
+
+	if matched == nil {
+		matched = wildcard
+	}
+	if matched == nil {
+		return &robotsRules{}
+	}
+	return &matched.rules
+}
+
+// allowed applies the longest matching rule; Allow wins ties
+func (r *robotsRules) allowed(target *url.URL) bool {
+	path := target.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+
+	allow := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allow = rule.allow
+			longest = len(rule.pattern)
+		}
+	}
+
+	return allow
+}
+
+// robotsMatch supports the "*" wildcard and "$" end anchor
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i, part := range strings.Split(pattern, "*") {
+		if i > 0 {
+			expr.WriteString(".*")
+		}
+		expr.WriteString(regexp.QuoteMeta(part))
+	}
+	if anchored {
+		expr.WriteString("$")
+	}
+
+	matched, err := regexp.MatchString(expr.String(), path)
+	return err == nil && matched
+}
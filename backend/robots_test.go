@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/anything", true},
+		{"/private", "/private", true},
+		{"/private", "/private/page", true},
+		{"/private", "/public", false},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/dir/index.php?x=1", true},
+		{"/*.php$", "/index.php", true},
+		{"/*.php$", "/index.php?x=1", false},
+		{"/search$", "/search", true},
+		{"/search$", "/search/results", false},
+		{"/a*b*c", "/a-x-b-y-c", true},
+		{"/a*b*c", "/a-x-c", false},
+		{"/file.html", "/fileXhtml", false}, // dots are literal
+	}
+
+	for _, tt := range tests {
+		if got := robotsMatch(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("robotsMatch(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseRobotsAllowed(t *testing.T) {
+	const robotsTxt = `
+# comments are ignored
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Crawl-delay: 2
+
+User-agent: OtherBot
+Disallow: /
+
+User-agent: WebCrawlerBot
+User-agent: AnotherBot
+Disallow: /bot-only
+Allow: /bot-only/open
+Disallow: /tie
+Allow: /tie
+`
+
+	tests := []struct {
+		name  string
+		agent string
+		path  string
+		want  bool
+	}{
+		{"wildcard group allows unlisted path", "somebot", "/", true},
+		{"wildcard group disallows prefix", "somebot", "/private/page", false},
+		{"longer allow beats shorter disallow", "somebot", "/private/public/page", true},
+		{"end anchor matches", "somebot", "/docs/file.pdf", false},
+		{"end anchor ignores longer paths", "somebot", "/docs/file.pdf?download=1", true},
+		{"specific group replaces wildcard group", "webcrawlerbot", "/private/page", true},
+		{"specific group rules apply", "webcrawlerbot", "/bot-only/page", false},
+		{"longest match within group", "webcrawlerbot", "/bot-only/open/page", true},
+		{"allow wins a tie", "webcrawlerbot", "/tie", true},
+		{"grouped user-agent lines share rules", "anotherbot", "/bot-only", false},
+		{"disallow all group", "otherbot", "/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(robotsTxt), tt.agent)
+			target, _ := url.Parse("https://example.com" + tt.path)
+			if got := rules.allowed(target); got != tt.want {
+				t.Errorf("allowed(%q) for %s = %v, want %v", tt.path, tt.agent, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRobotsCrawlDelay(t *testing.T) {
+	rules := parseRobots(strings.NewReader("User-agent: *\nCrawl-delay: 1.5\n"), "webcrawlerbot")
+	if rules.crawlDelay != 1500*time.Millisecond {
+		t.Errorf("crawlDelay = %v, want 1.5s", rules.crawlDelay)
+	}
+
+	rules = parseRobots(strings.NewReader("User-agent: otherbot\nDisallow: /\n"), "webcrawlerbot")
+	target, _ := url.Parse("https://example.com/")
+	if !rules.allowed(target) {
+		t.Error("a file without a matching group should allow everything")
+	}
+}
+
+func TestRobotsUnavailable(t *testing.T) {
+	serverError := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer serverError.Close()
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	cache := &robotsCache{entries: make(map[string]*robotsEntry)}
+	policy := &crawlPolicy{}
+
+	target, _ := url.Parse(serverError.URL + "/page")
+	_, err := cache.rulesFor(context.Background(), http.DefaultClient, target, policy)
+	var robotsErr *robotsServerError
+	if !errors.As(err, &robotsErr) || robotsErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("5xx robots.txt: error %v, want a robotsServerError with HTTP 503", err)
+	}
+	if errors.Is(err, errBlockedByRobots) {
+		t.Error("5xx robots.txt should not count as blocked by robots.txt")
+	}
+
+	target, _ = url.Parse(unreachable.URL + "/page")
+	if _, err := cache.rulesFor(context.Background(), http.DefaultClient, target, policy); err == nil {
+		t.Fatal("unreachable robots.txt should be an error, not allow-all")
+	}
+
+	// Failures are only cached briefly
+	for key, entry := range cache.entries {
+		if ttl := time.Until(entry.expiresAt); ttl > robotsRetryTTL {
+			t.Errorf("%s cached for %v, want at most %v", key, ttl, robotsRetryTTL)
+		}
+	}
+}
+
+func TestCheckLinkServerDown(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	for _, policy := range []*crawlPolicy{{}, {IgnoreRobots: true}} {
+		link := checkLink(context.Background(), http.DefaultClient, down.URL+"/page", policy)
+		if link == nil {
+			t.Fatalf("IgnoreRobots=%v: link to a host answering 503 was not reported", policy.IgnoreRobots)
+		}
+		if link.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("IgnoreRobots=%v: status %d, want 503", policy.IgnoreRobots, link.StatusCode)
+		}
+	}
+
+	// The root page fails with the server's status, not as blocked
+	_, _, err := fetchPage(context.Background(), http.DefaultClient, down.URL+"/", &crawlPolicy{})
+	if err == nil || errors.Is(err, errBlockedByRobots) {
+		t.Errorf("fetchPage error = %v, want a server error", err)
+	}
+	if err != nil && !strings.Contains(err.Error(), "503") {
+		t.Errorf("fetchPage error %q doesn't mention the status", err)
+	}
+}
+
+func TestCrawlRedirectChecksEachHop(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/origin-robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /secret\n"))
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer target.Close()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			// robots.txt redirects are followed too
+			http.Redirect(w, r, target.URL+"/origin-robots.txt", http.StatusMovedPermanently)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/ftp":
+			http.Redirect(w, r, "ftp://example.com/file", http.StatusFound)
+		default:
+			http.Redirect(w, r, target.URL+r.URL.Path, http.StatusFound)
+		}
+	}))
+	defer origin.Close()
+
+	// Same redirect handling as newCrawlClient, without the address checks
+	client := &http.Client{CheckRedirect: checkRedirect}
+	policy := &crawlPolicy{}
+
+	get := func(path string) (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodGet, origin.URL+path, nil)
+		return doCrawlRequest(context.Background(), client, req, policy)
+	}
+
+	resp, err := get("/public")
+	if err != nil {
+		t.Fatalf("allowed redirect: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Request.URL.String(); got != target.URL+"/public" {
+		t.Errorf("final URL %s, want %s", got, target.URL+"/public")
+	}
+
+	if _, err := get("/private"); !errors.Is(err, errBlockedByRobots) {
+		t.Errorf("redirect to a disallowed path: error %v, want errBlockedByRobots", err)
+	}
+
+	if _, err := get("/secret"); !errors.Is(err, errBlockedByRobots) {
+		t.Errorf("robots.txt behind a redirect: error %v, want errBlockedByRobots", err)
+	}
+
+	if _, err := get("/loop"); err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("redirect loop: error %v, want a redirect limit error", err)
+	}
+	if _, err := get("/ftp"); err == nil {
+		t.Error("redirect to ftp:// should fail")
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Roles, from least to most privileged. Each role can do everything the
+// roles below it can.
+const (
+	roleViewer   = "viewer"
+	roleOperator = "operator"
+	roleAdmin    = "admin"
+)
+
+var roleRank = map[string]int{
+	roleViewer:   1,
+	roleOperator: 2,
+	roleAdmin:    3,
+}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=viewer operator admin"`
+}
+
+// defaultRole is given to accounts created through /register
+func defaultRole() string {
+	if role := os.Getenv("DEFAULT_USER_ROLE"); roleRank[role] > 0 {
+		return role
+	}
+	return roleViewer
+}
+
+// hasRole reports whether the authenticated user has at least the given role
+func hasRole(c *gin.Context, role string) bool {
+	return roleRank[c.GetString("role")] >= roleRank[role]
+}
+
+// forbidden rejects a request made without the required role
+func forbidden(c *gin.Context, required string) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error":         "Insufficient permissions",
+		"code":          "forbidden",
+		"required_role": required,
+		"role":          c.GetString("role"),
+	})
+}
+
+// requireRole only lets through users with at least the given role. It must
+// run after authMiddleware.
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasRole(c, role) {
+			forbidden(c, role)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ensureAdmin promotes the oldest account when no admin exists, so
+// databases created before roles keep someone who can manage users
+func ensureAdmin() {
+	var count int64
+	if err := db.Model(&User{}).Where("role = ?", roleAdmin).Count(&count).Error; err != nil || count > 0 {
+		return
+	}
+
+	var user User
+	if err := db.Order("id").First(&user).Error; err != nil {
+		return
+	}
+
+	if err := db.Model(&user).Update("role", roleAdmin).Error; err != nil {
+		log.Printf("Failed to promote user %q to admin: %v", user.Username, err)
+		return
+	}
+	log.Printf("Promoted user %q to admin", user.Username)
+}
+
+// deleteURLs removes URLs together with their results and run history
+func deleteURLs(tx *gorm.DB, urlIDs []uint) error {
+	if len(urlIDs) == 0 {
+		return nil
+	}
+	if err := tx.Where("id IN ?", urlIDs).Delete(&URL{}).Error; err != nil {
+		return err
+	}
+	tx.Where("url_id IN ?", urlIDs).Delete(&BrokenLink{})
+	tx.Where("url_id IN ?", urlIDs).Delete(&CrawledPage{})
+	tx.Where("url_id IN ?", urlIDs).Delete(&PageMeta{})
+	tx.Where("url_id IN ?", urlIDs).Delete(&StructuredData{})
+	tx.Where("url_id IN ?", urlIDs).Delete(&AccessibilityAudit{})
+	tx.Where("url_id IN ?", urlIDs).Delete(&CrawlRun{})
+	return nil
+}
+
+// User management endpoints (admin only)
+func loadManagedUser(c *gin.Context) (*User, bool) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	var user User
+	if err := db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// isLastAdmin reports whether removing the user's admin role would leave no admins
+func isLastAdmin(user *User) bool {
+	if user.Role != roleAdmin {
+		return false
+	}
+	var count int64
+	db.Model(&User{}).Where("role = ? AND id <> ?", roleAdmin, user.ID).Count(&count)
+	return count == 0
+}
+
+func listUsers(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	var users []User
+	if err := db.Order("id").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+func updateUserRole(c *gin.Context) {
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+
+	if req.Role != roleAdmin && isLastAdmin(user) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot demote the last admin"})
+		return
+	}
+
+	// A demoted user is signed out everywhere so their tokens can't keep
+	// the old role until they expire. Promotions apply on the next refresh.
+	demoted := roleRank[req.Role] < roleRank[user.Role]
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("role", req.Role).Error; err != nil {
+			return err
+		}
+		if !demoted {
+			return nil
+		}
+		return tx.Model(&Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func deleteUser(c *gin.Context) {
+	user, ok := loadManagedUser(c)
+	if !ok {
+		return
+	}
+
+	if user.ID == c.GetUint("user_id") {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot delete your own account"})
+		return
+	}
+	if isLastAdmin(user) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot delete the last admin"})
+		return
+	}
+
+	// The user's URLs go with the account, except those filed under a
+	// project which stay with the organisation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var urlIDs []uint
+		if err := tx.Model(&URL{}).Where("user_id = ? AND project_id IS NULL", user.ID).Pluck("id", &urlIDs).Error; err != nil {
+			return err
+		}
+		if err := deleteURLs(tx, urlIDs); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&StreamTicket{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&APIKey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		webhookIDs := tx.Model(&Webhook{}).Select("id").Where("user_id = ?", user.ID)
+		if err := tx.Where("webhook_id IN (?)", webhookIDs).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&Webhook{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(user).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User deleted",
+		"user_id": user.ID,
+	})
+}
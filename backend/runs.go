@@ -0,0 +1,207 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CrawlRun is one crawl of a URL. The URL row mirrors its latest run.
+type CrawlRun struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	URLID        uint       `json:"url_id" gorm:"index"`
+	Status       string     `json:"status"` // running, done, error, stopped, blocked
+	CrawlMode    string     `json:"crawl_mode"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	PagesCrawled int        `json:"pages_crawled"`
+
+	// Analysis results of this run
+	PageAnalysis
+	ErrorMessage string `json:"error_message"`
+}
+
+type CrawlRunDetailResponse struct {
+	Run            CrawlRun             `json:"run"`
+	BrokenLinks    []BrokenLink         `json:"broken_links"`
+	BrokenAssets   []BrokenLink         `json:"broken_assets"`
+	Pages          []CrawledPage        `json:"pages,omitempty"`
+	Site           *SiteSummary         `json:"site,omitempty"`
+	Meta           []PageMeta           `json:"meta"`
+	StructuredData []StructuredData     `json:"structured_data"`
+	Accessibility  []AccessibilityAudit `json:"accessibility"`
+}
+
+// runResults holds everything recorded for one run besides its analysis
+type runResults struct {
+	BrokenLinks    []BrokenLink
+	BrokenAssets   []BrokenLink
+	Pages          []CrawledPage
+	Site           *SiteSummary
+	Meta           []PageMeta
+	StructuredData []StructuredData
+	Accessibility  []AccessibilityAudit
+}
+
+// startRun records the beginning of a crawl. Runs of the same URL still
+// marked as running were interrupted, since a URL is only crawled by one
+// worker at a time.
+func startRun(urlRecord *URL) (*CrawlRun, error) {
+	db.Model(&CrawlRun{}).
+		Where("url_id = ? AND status = ?", urlRecord.ID, "running").
+		Updates(map[string]interface{}{"status": "error", "error_message": "Crawl interrupted", "finished_at": time.Now()})
+
+	run := CrawlRun{
+		URLID:     urlRecord.ID,
+		Status:    "running",
+		CrawlMode: urlRecord.CrawlMode,
+		StartedAt: time.Now(),
+	}
+	if err := db.Create(&run).Error; err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// finishRun records the outcome of a crawl on the run and mirrors it on the URL
+func finishRun(urlRecord *URL, run *CrawlRun, status, message string) {
+	now := time.Now()
+
+	run.Status = status
+	run.ErrorMessage = message
+	run.FinishedAt = &now
+	db.Save(run)
+
+	urlRecord.Status = status
+	urlRecord.ErrorMessage = message
+	saveURL(urlRecord)
+
+	publishStatus(urlRecord)
+	publishSummary(urlRecord, run)
+	dispatchWebhooks(urlRecord, run)
+}
+
+// loadRunResults loads the broken links, broken assets and pages of a run
+func loadRunResults(urlID, runID uint, siteMode bool) runResults {
+	var results runResults
+
+	// Broken navigation links and broken assets are listed separately
+	db.Where("url_id = ? AND run_id = ? AND resource_type = ?", urlID, runID, "link").Find(&results.BrokenLinks)
+	db.Where("url_id = ? AND run_id = ? AND resource_type <> ?", urlID, runID, "link").Find(&results.BrokenAssets)
+
+	// SEO metadata, structured data and accessibility audits of every
+	// analysed page, the start page first
+	db.Where("url_id = ? AND run_id = ?", urlID, runID).Order("id").Find(&results.Meta)
+	db.Where("url_id = ? AND run_id = ?", urlID, runID).Order("page_meta_id, id").Find(&results.StructuredData)
+	db.Where("url_id = ? AND run_id = ?", urlID, runID).Order("id").Find(&results.Accessibility)
+
+	// Site crawls also report every visited page and site-wide totals
+	if siteMode {
+		db.Where("url_id = ? AND run_id = ?", urlID, runID).Order("depth, id").Find(&results.Pages)
+
+		if summary, err := siteSummary(urlID, runID); err == nil {
+			results.Site = summary
+		}
+	}
+
+	return results
+}
+
+// API Handlers
+func getURLRuns(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID"})
+		return
+	}
+
+	var urlRecord URL
+	if err := ownedURLs(c).First(&urlRecord, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	var req PaginationRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+
+	query := db.Model(&CrawlRun{}).Where("url_id = ?", urlRecord.ID)
+
+	var total int64
+	query.Count(&total)
+
+	var runs []CrawlRun
+	offset := (req.Page - 1) * req.PageSize
+	if err := query.Order("started_at desc, id desc").Limit(req.PageSize).Offset(offset).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch crawl runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       runs,
+		Total:      total,
+		Page:       req.Page,
+		PageSize:   req.PageSize,
+		TotalPages: int((total + int64(req.PageSize) - 1) / int64(req.PageSize)),
+	})
+}
+
+func getURLRun(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID"})
+		return
+	}
+
+	runID, err := strconv.Atoi(c.Param("runId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+
+	var urlRecord URL
+	if err := ownedURLs(c).First(&urlRecord, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	var run CrawlRun
+	if err := db.Where("id = ? AND url_id = ?", runID, urlRecord.ID).First(&run).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Crawl run not found"})
+		return
+	}
+
+	results := loadRunResults(run.URLID, run.ID, run.CrawlMode == "site")
+
+	c.JSON(http.StatusOK, CrawlRunDetailResponse{
+		Run:            run,
+		BrokenLinks:    results.BrokenLinks,
+		BrokenAssets:   results.BrokenAssets,
+		Pages:          results.Pages,
+		Site:           results.Site,
+		Meta:           results.Meta,
+		StructuredData: results.StructuredData,
+		Accessibility:  results.Accessibility,
+	})
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// Scheduled recurring crawls
+const (
+	minScheduleInterval = 60    // seconds
+	maxScheduleJitter   = 86400 // seconds
+)
+
+// Schedule columns are edited through the schedule endpoints and the
+// scheduler, never by the crawler.
+var scheduleColumns = []string{"schedule_cron", "schedule_interval", "schedule_jitter", "schedule_paused", "next_run_at"}
+
+type ScheduleRequest struct {
+	Cron     string `json:"cron"`                             // standard 5-field cron expression
+	Interval int    `json:"interval" binding:"min=0"`         // seconds between runs
+	Jitter   int    `json:"jitter" binding:"min=0,max=86400"` // up to this many seconds are added to each run
+}
+
+// nextScheduledRun returns when a scheduled URL is due next, or nil if it
+// has no schedule.
+func nextScheduledRun(urlRecord *URL, after time.Time) (*time.Time, error) {
+	var next time.Time
+
+	switch {
+	case urlRecord.ScheduleCron != "":
+		schedule, err := cron.ParseStandard(urlRecord.ScheduleCron)
+		if err != nil {
+			return nil, err
+		}
+		next = schedule.Next(after)
+	case urlRecord.ScheduleInterval > 0:
+		next = after.Add(time.Duration(urlRecord.ScheduleInterval) * time.Second)
+	default:
+		return nil, nil
+	}
+
+	// Jitter spreads out URLs sharing the same schedule. Rows saved before
+	// the limit existed are clamped so the duration can't overflow.
+	if jitter := urlRecord.ScheduleJitter; jitter > 0 {
+		if jitter > maxScheduleJitter {
+			jitter = maxScheduleJitter
+		}
+		next = next.Add(time.Duration(rand.Int63n(int64(jitter) * int64(time.Second))))
+	}
+
+	return &next, nil
+}
+
+// runScheduler periodically queues URLs whose schedule is due
+func runScheduler() {
+	interval := time.Duration(getEnvInt("SCHEDULER_INTERVAL_SECONDS", 30)) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if db == nil {
+			continue
+		}
+		enqueueDueURLs()
+	}
+}
+
+func enqueueDueURLs() {
+	now := time.Now()
+
+	var due []URL
+	if err := db.Where("schedule_paused = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", false, now).
+		Order("next_run_at").
+		Limit(100).
+		Find(&due).Error; err != nil {
+		log.Printf("Scheduler failed to load due URLs: %v", err)
+		return
+	}
+
+	queued := 0
+	for i := range due {
+		urlRecord := &due[i]
+
+		next, err := nextScheduledRun(urlRecord, now)
+		if err != nil {
+			log.Printf("Invalid schedule for URL %s: %v", urlRecord.URL, err)
+			continue
+		}
+
+		// Matching on the previous next_run_at makes sure only one replica
+		// queues this occurrence. URLs that are already queued or running
+		// skip it.
+		result := db.Model(&URL{}).
+			Where("id = ? AND next_run_at = ?", urlRecord.ID, urlRecord.NextRunAt).
+			Updates(map[string]interface{}{
+				"next_run_at": next,
+				"status":      gorm.Expr("CASE WHEN status IN ? THEN status ELSE ? END", []string{"queued", "running"}, "queued"),
+			})
+		if result.Error != nil {
+			log.Printf("Scheduler failed to queue URL %s: %v", urlRecord.URL, result.Error)
+			continue
+		}
+		if result.RowsAffected > 0 {
+			queued++
+			queue.notify()
+			if urlRecord.Status != "queued" && urlRecord.Status != "running" {
+				urlRecord.Status = "queued"
+				publishStatus(urlRecord)
+			}
+		}
+	}
+
+	if queued > 0 {
+		log.Printf("Scheduler queued %d URLs", queued)
+	}
+}
+
+// API Handlers
+func loadScheduledURL(c *gin.Context) (*URL, bool) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID"})
+		return nil, false
+	}
+
+	var urlRecord URL
+	if err := ownedURLs(c).First(&urlRecord, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return nil, false
+	}
+
+	return &urlRecord, true
+}
+
+func setSchedule(c *gin.Context) {
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if (req.Cron == "") == (req.Interval == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either a cron expression or an interval"})
+		return
+	}
+	if req.Cron != "" {
+		if _, err := cron.ParseStandard(req.Cron); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cron expression: " + err.Error()})
+			return
+		}
+	}
+	if req.Interval > 0 && req.Interval < minScheduleInterval {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Interval must be at least 60 seconds"})
+		return
+	}
+
+	urlRecord, ok := loadScheduledURL(c)
+	if !ok {
+		return
+	}
+
+	urlRecord.ScheduleCron = req.Cron
+	urlRecord.ScheduleInterval = req.Interval
+	urlRecord.ScheduleJitter = req.Jitter
+	urlRecord.SchedulePaused = false
+
+	next, err := nextScheduledRun(urlRecord, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	urlRecord.NextRunAt = next
+
+	if err := db.Model(urlRecord).Select("schedule_cron", "schedule_interval", "schedule_jitter", "schedule_paused", "next_run_at").Updates(urlRecord).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, urlRecord)
+}
+
+func deleteSchedule(c *gin.Context) {
+	urlRecord, ok := loadScheduledURL(c)
+	if !ok {
+		return
+	}
+
+	if err := db.Model(urlRecord).Updates(map[string]interface{}{
+		"schedule_cron":     "",
+		"schedule_interval": 0,
+		"schedule_jitter":   0,
+		"schedule_paused":   false,
+		"next_run_at":       nil,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Schedule removed",
+		"url_id":  urlRecord.ID,
+	})
+}
+
+func pauseSchedule(c *gin.Context) {
+	urlRecord, ok := loadScheduledURL(c)
+	if !ok {
+		return
+	}
+
+	if urlRecord.ScheduleCron == "" && urlRecord.ScheduleInterval == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "URL has no schedule"})
+		return
+	}
+
+	if err := db.Model(urlRecord).Updates(map[string]interface{}{
+		"schedule_paused": true,
+		"next_run_at":     nil,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pause schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Schedule paused",
+		"url_id":  urlRecord.ID,
+	})
+}
+
+func resumeSchedule(c *gin.Context) {
+	urlRecord, ok := loadScheduledURL(c)
+	if !ok {
+		return
+	}
+
+	// Resuming starts counting from now rather than catching up on missed runs
+	next, err := nextScheduledRun(urlRecord, time.Now())
+	if err == nil && next == nil {
+		err = errors.New("URL has no schedule")
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.Model(urlRecord).Updates(map[string]interface{}{
+		"schedule_paused": false,
+		"next_run_at":     next,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Schedule resumed",
+		"url_id":      urlRecord.ID,
+		"next_run_at": next,
+	})
+}
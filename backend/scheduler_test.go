@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNextScheduledRun(t *testing.T) {
+	after := time.Date(2024, 3, 1, 10, 7, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		url     URL
+		want    time.Time
+		maxLate time.Duration // jitter allowed on top of want
+		none    bool
+		wantErr bool
+	}{
+		{name: "no schedule", url: URL{}, none: true},
+		{name: "interval", url: URL{ScheduleInterval: 3600}, want: after.Add(time.Hour)},
+		{name: "cron", url: URL{ScheduleCron: "0 * * * *"}, want: time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)},
+		{name: "cron wins over interval", url: URL{ScheduleCron: "30 10 * * *", ScheduleInterval: 60}, want: time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)},
+		{name: "invalid cron", url: URL{ScheduleCron: "every day"}, wantErr: true},
+		{name: "jitter", url: URL{ScheduleInterval: 3600, ScheduleJitter: 300}, want: after.Add(time.Hour), maxLate: 300 * time.Second},
+		{name: "oversized jitter is clamped", url: URL{ScheduleInterval: 3600, ScheduleJitter: 1e10}, want: after.Add(time.Hour), maxLate: maxScheduleJitter * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Jitter is random, so try a few times
+			for i := 0; i < 20; i++ {
+				next, err := nextScheduledRun(&tt.url, after)
+				if tt.wantErr {
+					if err == nil {
+						t.Fatal("want an error")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.none {
+					if next != nil {
+						t.Fatalf("next = %v, want nil", next)
+					}
+					return
+				}
+				if next.Before(tt.want) || next.After(tt.want.Add(tt.maxLate)) {
+					t.Fatalf("next = %v, want between %v and %v", next, tt.want, tt.want.Add(tt.maxLate))
+				}
+			}
+		})
+	}
+}
+
+func TestSetScheduleValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/urls/:id/schedule", setSchedule)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"jitter above the limit", `{"interval": 3600, "jitter": 10000000000}`},
+		{"negative jitter", `{"interval": 3600, "jitter": -1}`},
+		{"interval too short", `{"interval": 30}`},
+		{"neither cron nor interval", `{"jitter": 60}`},
+		{"both cron and interval", `{"cron": "0 * * * *", "interval": 3600}`},
+		{"invalid cron", `{"cron": "sometimes"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, "/urls/1/schedule", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestEnqueueDueURLs(t *testing.T) {
+	openTestDB(t)
+	previousQueue := queue
+	queue = &crawlQueue{wake: make(chan struct{}, 10)}
+	t.Cleanup(func() { queue = previousQueue })
+
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	urls := map[string]*URL{
+		"due":     {URL: "https://example.com/due", Status: "done", ScheduleInterval: 3600, NextRunAt: &past},
+		"running": {URL: "https://example.com/running", Status: "running", ScheduleInterval: 3600, NextRunAt: &past},
+		"paused":  {URL: "https://example.com/paused", Status: "done", ScheduleInterval: 3600, NextRunAt: &past, SchedulePaused: true},
+		"later":   {URL: "https://example.com/later", Status: "done", ScheduleInterval: 3600, NextRunAt: &future},
+		"huge":    {URL: "https://example.com/huge", Status: "done", ScheduleInterval: 3600, ScheduleJitter: 1e10, NextRunAt: &past},
+	}
+	for _, u := range urls {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	enqueueDueURLs()
+
+	want := map[string]struct {
+		status string
+		future bool // next_run_at is after now
+	}{
+		"due":     {"queued", true},
+		"running": {"running", true}, // this occurrence is skipped, not queued twice
+		"paused":  {"done", false},
+		"later":   {"done", true},
+		"huge":    {"queued", true},
+	}
+	for name, u := range urls {
+		var got URL
+		db.First(&got, u.ID)
+		if got.Status != want[name].status {
+			t.Errorf("%s: status = %q, want %q", name, got.Status, want[name].status)
+		}
+		future := got.NextRunAt != nil && got.NextRunAt.After(now)
+		if future != want[name].future {
+			t.Errorf("%s: next_run_at = %v, in the future = %v, want %v", name, got.NextRunAt, future, want[name].future)
+		}
+	}
+}
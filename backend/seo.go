@@ -0,0 +1,232 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Recommended lengths, in characters, used by the SEO checks
+const (
+	minTitleLength       = 10
+	maxTitleLength       = 60
+	minDescriptionLength = 50
+	maxDescriptionLength = 160
+)
+
+// PageMeta holds the SEO metadata of one page of a crawl run and the
+// problems found in it
+type PageMeta struct {
+	ID          uint              `json:"id" gorm:"primaryKey"`
+	URLID       uint              `json:"url_id" gorm:"index"`
+	RunID       uint              `json:"run_id" gorm:"index"`
+	PageURL     string            `json:"page_url"`
+	Description string            `json:"description" gorm:"type:text"`
+	Robots      string            `json:"robots"`
+	Canonical   string            `json:"canonical" gorm:"type:text"`
+	Hreflang    []HreflangLink    `json:"hreflang" gorm:"type:text;serializer:json"`
+	OpenGraph   map[string]string `json:"open_graph" gorm:"type:text;serializer:json"`
+	TwitterCard map[string]string `json:"twitter_card" gorm:"type:text;serializer:json"`
+	Viewport    string            `json:"viewport"`
+	Charset     string            `json:"charset"`
+	Findings    []SEOFinding      `json:"findings" gorm:"type:text;serializer:json"`
+	CreatedAt   time.Time         `json:"created_at"`
+
+	// Saved with the record and served separately
+	StructuredData []StructuredData `json:"-" gorm:"foreignKey:PageMetaID"`
+
+	// Counted during the walk to spot duplicates
+	descriptions int
+	canonicals   int
+}
+
+type HreflangLink struct {
+	Lang string `json:"lang"`
+	Href string `json:"href"`
+}
+
+type SEOFinding struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"` // error, warning, notice
+	Message  string `json:"message"`
+}
+
+// collectMeta records the SEO relevant <meta> and <link> elements. A nil
+// meta ignores them.
+func collectMeta(n *html.Node, meta *PageMeta, baseURL string) {
+	if meta == nil {
+		return
+	}
+
+	switch n.Data {
+	case "meta":
+		name := strings.ToLower(attrValue(n, "name"))
+		property := strings.ToLower(attrValue(n, "property"))
+		content := strings.TrimSpace(attrValue(n, "content"))
+
+		switch {
+		case attrValue(n, "charset") != "":
+			meta.Charset = strings.TrimSpace(attrValue(n, "charset"))
+		case strings.EqualFold(attrValue(n, "http-equiv"), "content-type"):
+			if i := strings.Index(strings.ToLower(content), "charset="); i >= 0 {
+				meta.Charset = strings.TrimSpace(content[i+len("charset="):])
+			}
+		case name == "description":
+			meta.descriptions++
+			if meta.Description == "" {
+				meta.Description = content
+			}
+		case name == "robots":
+			meta.Robots = content
+		case name == "viewport":
+			meta.Viewport = content
+		case strings.HasPrefix(property, "og:"):
+			if meta.OpenGraph == nil {
+				meta.OpenGraph = make(map[string]string)
+			}
+			meta.OpenGraph[property] = content
+		case strings.HasPrefix(name, "twitter:") || strings.HasPrefix(property, "twitter:"):
+			key := name
+			if key == "" {
+				key = property
+			}
+			if meta.TwitterCard == nil {
+				meta.TwitterCard = make(map[string]string)
+			}
+			meta.TwitterCard[key] = content
+		}
+	case "link":
+		rel := attrValue(n, "rel")
+		href := resolveURL(strings.TrimSpace(attrValue(n, "href")), baseURL)
+		switch {
+		case hasToken(rel, "canonical"):
+			meta.canonicals++
+			if meta.Canonical == "" {
+				meta.Canonical = href
+			}
+		case hasToken(rel, "alternate") && attrValue(n, "hreflang") != "":
+			meta.Hreflang = append(meta.Hreflang, HreflangLink{Lang: attrValue(n, "hreflang"), Href: href})
+		}
+	}
+}
+
+// validate checks the collected metadata against the page's title.
+// allowNoindex is set for pages that are meant to stay out of search results.
+func (meta *PageMeta) validate(analysis *PageAnalysis, allowNoindex bool) {
+	meta.Findings = []SEOFinding{}
+	add := meta.addFinding
+
+	title := strings.TrimSpace(analysis.Title)
+	switch titleLength := utf8.RuneCountInString(title); {
+	case title == "" || title == "Untitled":
+		add("title_missing", "error", "Page has no title")
+	case titleLength < minTitleLength:
+		add("title_too_short", "warning", "Title is shorter than 10 characters")
+	case titleLength > maxTitleLength:
+		add("title_too_long", "warning", "Title is longer than 60 characters")
+	}
+
+	switch descriptionLength := utf8.RuneCountInString(meta.Description); {
+	case meta.descriptions == 0 || meta.Description == "":
+		add("description_missing", "warning", "Page has no meta description")
+	case descriptionLength < minDescriptionLength:
+		add("description_too_short", "notice", "Meta description is shorter than 50 characters")
+	case descriptionLength > maxDescriptionLength:
+		add("description_too_long", "notice", "Meta description is longer than 160 characters")
+	}
+	if meta.descriptions > 1 {
+		add("description_duplicate", "warning", "Page has more than one meta description")
+	}
+
+	if meta.canonicals > 1 {
+		add("canonical_duplicate", "warning", "Page has more than one canonical link")
+	}
+	if meta.Canonical != "" {
+		canonical, err := url.Parse(meta.Canonical)
+		page, pageErr := url.Parse(meta.PageURL)
+		switch {
+		case err != nil || !canonical.IsAbs():
+			add("canonical_invalid", "error", "Canonical link is not a valid absolute URL")
+		case pageErr == nil && !strings.EqualFold(canonical.Hostname(), page.Hostname()):
+			add("canonical_off_host", "warning", "Canonical link points to another host: "+canonical.Hostname())
+		}
+	}
+
+	if !allowNoindex {
+		for _, directive := range strings.Split(meta.Robots, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if directive == "noindex" || directive == "none" {
+				add("noindex", "error", "Page asks search engines not to index it")
+				break
+			}
+		}
+	}
+
+	if meta.Viewport == "" {
+		add("viewport_missing", "warning", "Page has no viewport meta tag")
+	}
+	if meta.Charset == "" {
+		add("charset_missing", "notice", "Page doesn't declare its character encoding")
+	}
+
+	// Notices are suggestions and don't count as issues
+	analysis.SEOIssues = 0
+	for _, finding := range meta.Findings {
+		if finding.Severity != "notice" {
+			analysis.SEOIssues++
+		}
+	}
+}
+
+func (meta *PageMeta) addFinding(code, severity, message string) {
+	meta.Findings = append(meta.Findings, SEOFinding{Code: code, Severity: severity, Message: message})
+}
+
+// metaIndex remembers the titles and descriptions seen during a crawl so
+// pages repeating another page's are flagged. A nil index checks nothing.
+type metaIndex struct {
+	titles       map[string]string // lower-cased text -> first page using it
+	descriptions map[string]string
+}
+
+func newMetaIndex() *metaIndex {
+	return &metaIndex{
+		titles:       make(map[string]string),
+		descriptions: make(map[string]string),
+	}
+}
+
+// check flags a validated page whose title or description was already used
+// by an earlier page of the crawl
+func (idx *metaIndex) check(meta *PageMeta, analysis *PageAnalysis) {
+	if idx == nil {
+		return
+	}
+
+	if title := strings.TrimSpace(analysis.Title); title != "" && title != "Untitled" {
+		if first, ok := idx.titles[strings.ToLower(title)]; ok {
+			meta.addFinding("title_reused", "warning", "Title is the same as on "+first)
+			analysis.SEOIssues++
+		} else {
+			idx.titles[strings.ToLower(title)] = meta.PageURL
+		}
+	}
+
+	if description := strings.TrimSpace(meta.Description); description != "" {
+		if first, ok := idx.descriptions[strings.ToLower(description)]; ok {
+			meta.addFinding("description_reused", "warning", "Meta description is the same as on "+first)
+			analysis.SEOIssues++
+		} else {
+			idx.descriptions[strings.ToLower(description)] = meta.PageURL
+		}
+	}
+}
+
+// attrValue returns an attribute's value, or "" if it isn't set
+func attrValue(n *html.Node, key string) string {
+	value, _ := getAttr(n, key)
+	return value
+}
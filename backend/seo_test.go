@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	goodTitle       = "Handmade oak furniture"
+	goodDescription = "Tables, chairs and shelves made to order from sustainably grown oak."
+)
+
+// pageMetaFor analyses a page with the given <head> contents and validates
+// its metadata
+func pageMetaFor(t *testing.T, pageURL, head string, allowNoindex bool) (*PageMeta, *PageAnalysis) {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader("<html><head>" + head + "</head><body></body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := &PageMeta{PageURL: pageURL}
+	analysis := &PageAnalysis{}
+	analyzeDocument(doc, analysis, meta, pageURL)
+	meta.validate(analysis, allowNoindex)
+	return meta, analysis
+}
+
+func findingCodes(meta *PageMeta) map[string]bool {
+	codes := make(map[string]bool)
+	for _, finding := range meta.Findings {
+		codes[finding.Code] = true
+	}
+	return codes
+}
+
+func TestPageMetaValidate(t *testing.T) {
+	base := `<meta charset="utf-8"><meta name="viewport" content="width=device-width">`
+	title := func(s string) string { return "<title>" + s + "</title>" }
+	description := func(s string) string { return `<meta name="description" content="` + s + `">` }
+	good := base + title(goodTitle) + description(goodDescription)
+
+	tests := []struct {
+		name         string
+		head         string
+		allowNoindex bool
+		want         string // finding expected, "" for none
+	}{
+		{"valid page", good, false, ""},
+
+		{"no title", base + description(goodDescription), false, "title_missing"},
+		{"title of 9 characters", base + title(strings.Repeat("a", 9)) + description(goodDescription), false, "title_too_short"},
+		{"title of 10 characters", base + title(strings.Repeat("a", 10)) + description(goodDescription), false, ""},
+		{"title of 60 characters", base + title(strings.Repeat("a", 60)) + description(goodDescription), false, ""},
+		{"title of 61 characters", base + title(strings.Repeat("a", 61)) + description(goodDescription), false, "title_too_long"},
+		{"title counted in characters", base + title(strings.Repeat("é", 60)) + description(goodDescription), false, ""},
+		{"title padded with spaces", base + title("  short  ") + description(goodDescription), false, "title_too_short"},
+
+		{"no description", base + title(goodTitle), false, "description_missing"},
+		{"empty description", base + title(goodTitle) + description(""), false, "description_missing"},
+		{"description of 49 characters", base + title(goodTitle) + description(strings.Repeat("a", 49)), false, "description_too_short"},
+		{"description of 50 characters", base + title(goodTitle) + description(strings.Repeat("a", 50)), false, ""},
+		{"description of 160 characters", base + title(goodTitle) + description(strings.Repeat("a", 160)), false, ""},
+		{"description of 161 characters", base + title(goodTitle) + description(strings.Repeat("a", 161)), false, "description_too_long"},
+		{"two descriptions", good + description("Another description"), false, "description_duplicate"},
+
+		{"canonical on the same host", good + `<link rel="canonical" href="https://Example.com/page">`, false, ""},
+		{"relative canonical", good + `<link rel="canonical" href="/page">`, false, ""},
+		{"off-host canonical", good + `<link rel="canonical" href="https://other.example/page">`, false, "canonical_off_host"},
+		{"subdomain canonical", good + `<link rel="canonical" href="https://www.example.com/page">`, false, "canonical_off_host"},
+		{"two canonicals", good + `<link rel="canonical" href="/a"><link rel="canonical" href="/b">`, false, "canonical_duplicate"},
+
+		{"noindex", good + `<meta name="robots" content="noindex, follow">`, false, "noindex"},
+		{"robots none", good + `<meta name="robots" content="NONE">`, false, "noindex"},
+		{"noindex allowed", good + `<meta name="robots" content="noindex, follow">`, true, ""},
+		{"index", good + `<meta name="robots" content="index, follow">`, false, ""},
+
+		{"no viewport", `<meta charset="utf-8">` + title(goodTitle) + description(goodDescription), false, "viewport_missing"},
+		{"charset from http-equiv", `<meta http-equiv="Content-Type" content="text/html; charset=utf-8"><meta name="viewport" content="width=device-width">` + title(goodTitle) + description(goodDescription), false, ""},
+	}
+
+	for _, tt := range tests {
+		meta, _ := pageMetaFor(t, "https://example.com/", tt.head, tt.allowNoindex)
+
+		codes := findingCodes(meta)
+		switch {
+		case tt.want == "" && len(codes) > 0:
+			t.Errorf("%s: unexpected findings %+v", tt.name, meta.Findings)
+		case tt.want != "" && (!codes[tt.want] || len(codes) > 1):
+			t.Errorf("%s: findings %+v, want only %s", tt.name, meta.Findings, tt.want)
+		}
+	}
+}
+
+func TestPageMetaCanonicalKeepsFirst(t *testing.T) {
+	meta, _ := pageMetaFor(t, "https://example.com/", `<link rel="canonical" href="/a"><link rel="canonical" href="https://other.example/b">`, false)
+	if meta.Canonical != "https://example.com/a" {
+		t.Errorf("canonical %q, want the first one resolved against the page", meta.Canonical)
+	}
+	if meta.canonicals != 2 {
+		t.Errorf("counted %d canonicals, want 2", meta.canonicals)
+	}
+}
+
+func TestPageMetaSEOIssues(t *testing.T) {
+	// title_missing (error), description_too_short (notice), noindex (error),
+	// viewport_missing (warning) and charset_missing (notice)
+	_, analysis := pageMetaFor(t, "https://example.com/", `<meta name="description" content="Too short"><meta name="robots" content="noindex">`, false)
+	if analysis.SEOIssues != 3 {
+		t.Errorf("SEOIssues = %d, want 3", analysis.SEOIssues)
+	}
+}
+
+func TestMetaIndex(t *testing.T) {
+	seen := newMetaIndex()
+	head := func(title, description string) string {
+		return `<meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>` + title +
+			`</title><meta name="description" content="` + description + `">`
+	}
+	otherDescription := "Opening hours, directions and parking near our Leeds workshop."
+
+	tests := []struct {
+		page string
+		head string
+		want []string
+	}{
+		{"https://example.com/", head(goodTitle, goodDescription), nil},
+		{"https://example.com/tables", head(strings.ToUpper(goodTitle), otherDescription), []string{"title_reused"}},
+		{"https://example.com/chairs", head("Oak chairs made to order", " "+goodDescription), []string{"description_reused"}},
+		{"https://example.com/shelves", head(goodTitle, goodDescription), []string{"title_reused", "description_reused"}},
+		{"https://example.com/contact", head("Contact the workshop", "Write to us about commissions, repairs and delivery."), nil},
+	}
+
+	for _, tt := range tests {
+		meta, analysis := pageMetaFor(t, tt.page, tt.head, false)
+		before := analysis.SEOIssues
+		seen.check(meta, analysis)
+
+		codes := findingCodes(meta)
+		if len(codes) != len(tt.want) {
+			t.Errorf("%s: findings %+v, want %v", tt.page, meta.Findings, tt.want)
+		}
+		for _, code := range tt.want {
+			if !codes[code] {
+				t.Errorf("%s: missing %s in %+v", tt.page, code, meta.Findings)
+			}
+		}
+		if analysis.SEOIssues != before+len(tt.want) {
+			t.Errorf("%s: SEOIssues = %d, want %d", tt.page, analysis.SEOIssues, before+len(tt.want))
+		}
+	}
+
+	// Findings name the first page that used the text
+	meta, analysis := pageMetaFor(t, "https://example.com/again", head(goodTitle, otherDescription), false)
+	seen.check(meta, analysis)
+	if len(meta.Findings) != 2 || !strings.HasSuffix(meta.Findings[0].Message, "https://example.com/") ||
+		!strings.HasSuffix(meta.Findings[1].Message, "https://example.com/tables") {
+		t.Errorf("findings %+v should point at the first pages", meta.Findings)
+	}
+
+	// A nil index is used for single pages
+	var none *metaIndex
+	none.check(meta, analysis)
+}
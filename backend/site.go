@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Site crawl limits applied when a URL does not set its own
+const (
+	defaultSiteMaxDepth = 2
+	defaultSiteMaxPages = 50
+)
+
+// CrawledPage is a single page visited during a site crawl
+type CrawledPage struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	URLID   uint   `json:"url_id" gorm:"index"`
+	RunID   uint   `json:"run_id" gorm:"index"`
+	PageURL string `json:"page_url"`
+	Depth   int    `json:"depth"`
+	PageAnalysis
+	ErrorMessage string    `json:"error_message"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// SiteSummary aggregates the analysis of every page visited in a site crawl
+type SiteSummary struct {
+	Pages              int `json:"pages"`
+	PagesWithErrors    int `json:"pages_with_errors"`
+	PagesWithLoginForm int `json:"pages_with_login_form"`
+	H1Count            int `json:"h1_count"`
+	H2Count            int `json:"h2_count"`
+	H3Count            int `json:"h3_count"`
+	H4Count            int `json:"h4_count"`
+	H5Count            int `json:"h5_count"`
+	H6Count            int `json:"h6_count"`
+	InternalLinks      int `json:"internal_links"`
+	ExternalLinks      int `json:"external_links"`
+	InaccessibleLinks  int `json:"inaccessible_links"`
+	BrokenAssets       int `json:"broken_assets"`
+}
+
+// siteScope decides which discovered links belong to the site being crawled
+type siteScope struct {
+	host       string
+	subdomains bool
+	include    *regexp.Regexp
+	exclude    *regexp.Regexp
+}
+
+type sitePage struct {
+	url   string
+	depth int
+}
+
+func newSiteScope(urlRecord *URL) (*siteScope, error) {
+	rootURL, err := url.Parse(urlRecord.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := &siteScope{
+		host:       strings.ToLower(rootURL.Hostname()),
+		subdomains: urlRecord.Scope == "subdomain",
+	}
+
+	if urlRecord.IncludePattern != "" {
+		if scope.include, err = regexp.Compile(urlRecord.IncludePattern); err != nil {
+			return nil, err
+		}
+	}
+	if urlRecord.ExcludePattern != "" {
+		if scope.exclude, err = regexp.Compile(urlRecord.ExcludePattern); err != nil {
+			return nil, err
+		}
+	}
+
+	return scope, nil
+}
+
+func (s *siteScope) allows(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host != s.host {
+		if !s.subdomains {
+			return false
+		}
+		// Treat www.example.com and example.com as the same registrable domain
+		base := strings.TrimPrefix(s.host, "www.")
+		if host != base && !strings.HasSuffix(host, "."+base) {
+			return false
+		}
+	}
+
+	if s.include != nil && !s.include.MatchString(u.Path) {
+		return false
+	}
+	if s.exclude != nil && s.exclude.MatchString(u.Path) {
+		return false
+	}
+
+	return true
+}
+
+func siteLimits(urlRecord *URL) (maxDepth, maxPages int) {
+	// The default depth is filled in when the URL is added, so 0 means
+	// only the root page
+	maxDepth = urlRecord.MaxDepth
+	if maxDepth < 0 {
+		maxDepth = 0
+	}
+
+	maxPages = urlRecord.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultSiteMaxPages
+	}
+	if limit := getEnvInt("SITE_MAX_PAGES", 500); maxPages > limit {
+		maxPages = limit
+	}
+
+	return maxDepth, maxPages
+}
+
+// crawlSite does a breadth-first crawl over the internal links of the root
+// page, storing every visited page as a CrawledPage. The root page has
+// already been analysed by crawlURL and is recorded at depth 0.
+func crawlSite(ctx context.Context, client *http.Client, urlRecord *URL, run *CrawlRun, rootDoc *html.Node, policy *crawlPolicy, progress *crawlProgress, seen *metaIndex) []BrokenLink {
+	scope, err := newSiteScope(urlRecord)
+	if err != nil {
+		log.Printf("Invalid site scope for URL %s: %v", urlRecord.URL, err)
+		return nil
+	}
+	maxDepth, maxPages := siteLimits(urlRecord)
+
+	root := CrawledPage{
+		URLID:        urlRecord.ID,
+		RunID:        run.ID,
+		PageURL:      urlRecord.URL,
+		PageAnalysis: urlRecord.PageAnalysis,
+	}
+	db.Create(&root)
+
+	var brokenLinks []BrokenLink
+	var frontier []sitePage
+	visited := map[string]bool{pageKey(urlRecord.URL): true}
+
+	enqueue := func(doc *html.Node, from sitePage) {
+		if from.depth >= maxDepth {
+			return
+		}
+
+		var links []linkRef
+		collectLinks(doc, &links)
+		for _, link := range links {
+			// Only navigation links lead to other pages
+			if link.Type != "link" {
+				continue
+			}
+
+			fullURL := resolveURL(link.URL, from.url)
+			linkURL, err := url.Parse(fullURL)
+			if fullURL == "" || err != nil || !scope.allows(linkURL) {
+				continue
+			}
+
+			key := pageKey(fullURL)
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+			frontier = append(frontier, sitePage{url: key, depth: from.depth + 1})
+		}
+	}
+
+	enqueue(rootDoc, sitePage{url: urlRecord.URL})
+	pages := 1
+
+	for len(frontier) > 0 && pages < maxPages && ctx.Err() == nil {
+		page := frontier[0]
+		frontier = frontier[1:]
+
+		record := CrawledPage{
+			URLID:   urlRecord.ID,
+			RunID:   run.ID,
+			PageURL: page.url,
+			Depth:   page.depth,
+		}
+
+		doc, finalURL, err := fetchPage(ctx, client, page.url, policy)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			// Pages disallowed by robots.txt are not part of the crawl
+			if errors.Is(err, errBlockedByRobots) {
+				continue
+			}
+			record.ErrorMessage = err.Error()
+			db.Create(&record)
+			pages++
+			progress.pageVisited()
+			continue
+		}
+
+		// A redirect may lead out of scope or to a page already visited
+		if final := pageKey(finalURL.String()); final != page.url {
+			if !scope.allows(finalURL) || visited[final] {
+				continue
+			}
+			visited[final] = true
+			page.url = final
+			record.PageURL = final
+		}
+
+		analyzePage(doc, &record.PageAnalysis, urlRecord, run, page.url, seen)
+
+		pageBrokenLinks := findBrokenLinks(ctx, doc, page.url, run, policy, progress)
+		countBrokenLinks(&record.PageAnalysis, pageBrokenLinks)
+		brokenLinks = append(brokenLinks, pageBrokenLinks...)
+
+		db.Create(&record)
+		pages++
+		progress.pageVisited()
+
+		enqueue(doc, page)
+	}
+
+	urlRecord.PagesCrawled = pages
+	log.Printf("Site crawl visited %d pages for URL: %s", pages, urlRecord.URL)
+
+	return brokenLinks
+}
+
+// pageKey identifies a page regardless of fragment and host case
+func pageKey(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return pageURL
+	}
+
+	u.Fragment = ""
+	u.Host = strings.ToLower(u.Host)
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+func siteSummary(urlID, runID uint) (*SiteSummary, error) {
+	var summary SiteSummary
+	err := db.Model(&CrawledPage{}).
+		Where("url_id = ? AND run_id = ?", urlID, runID).
+		Select(`COUNT(*) AS pages,
+			COALESCE(SUM(CASE WHEN error_message <> '' THEN 1 ELSE 0 END), 0) AS pages_with_errors,
+			COALESCE(SUM(CASE WHEN has_login_form THEN 1 ELSE 0 END), 0) AS pages_with_login_form,
+			COALESCE(SUM(h1_count), 0) AS h1_count,
+			COALESCE(SUM(h2_count), 0) AS h2_count,
+			COALESCE(SUM(h3_count), 0) AS h3_count,
+			COALESCE(SUM(h4_count), 0) AS h4_count,
+			COALESCE(SUM(h5_count), 0) AS h5_count,
+			COALESCE(SUM(h6_count), 0) AS h6_count,
+			COALESCE(SUM(internal_links), 0) AS internal_links,
+			COALESCE(SUM(external_links), 0) AS external_links,
+			COALESCE(SUM(inaccessible_links), 0) AS inaccessible_links,
+			COALESCE(SUM(broken_images + broken_scripts + broken_stylesheets + broken_iframes + broken_media), 0) AS broken_assets`).
+		Scan(&summary).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &summary, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSiteScopeAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		record URL
+		target string
+		want   bool
+	}{
+		{"same host", URL{URL: "https://example.com/"}, "https://example.com/about", true},
+		{"host case", URL{URL: "https://example.com/"}, "https://EXAMPLE.com/about", true},
+		{"other scheme on the host", URL{URL: "https://example.com/"}, "http://example.com/about", true},
+		{"non-http scheme", URL{URL: "https://example.com/"}, "ftp://example.com/file", false},
+		{"subdomain in host scope", URL{URL: "https://example.com/"}, "https://blog.example.com/", false},
+		{"other host", URL{URL: "https://example.com/"}, "https://example.org/", false},
+
+		{"subdomain", URL{URL: "https://example.com/", Scope: "subdomain"}, "https://blog.example.com/", true},
+		{"www root covers siblings", URL{URL: "https://www.example.com/", Scope: "subdomain"}, "https://shop.example.com/", true},
+		{"www root covers the bare domain", URL{URL: "https://www.example.com/", Scope: "subdomain"}, "https://example.com/", true},
+		{"suffix that isn't a subdomain", URL{URL: "https://example.com/", Scope: "subdomain"}, "https://badexample.com/", false},
+		{"parent domain", URL{URL: "https://blog.example.com/", Scope: "subdomain"}, "https://example.com/", false},
+
+		{"included prefix", URL{URL: "https://example.com/docs/", IncludePattern: "^/docs/"}, "https://example.com/docs/intro", true},
+		{"outside the included prefix", URL{URL: "https://example.com/docs/", IncludePattern: "^/docs/"}, "https://example.com/blog/post", false},
+		{"include ignores the query", URL{URL: "https://example.com/docs/", IncludePattern: `^/docs/[a-z]+$`}, "https://example.com/docs/intro?page=2", true},
+		{"excluded prefix", URL{URL: "https://example.com/", ExcludePattern: "^/admin"}, "https://example.com/admin/users", false},
+		{"not excluded", URL{URL: "https://example.com/", ExcludePattern: "^/admin"}, "https://example.com/blog/admin", true},
+		{"exclude wins over include", URL{URL: "https://example.com/", IncludePattern: "^/docs/", ExcludePattern: `\.pdf$`}, "https://example.com/docs/guide.pdf", false},
+		{"patterns with subdomains", URL{URL: "https://example.com/", Scope: "subdomain", IncludePattern: "^/docs/"}, "https://api.example.com/docs/v1", true},
+	}
+
+	for _, tt := range tests {
+		scope, err := newSiteScope(&tt.record)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		target, _ := url.Parse(tt.target)
+		if got := scope.allows(target); got != tt.want {
+			t.Errorf("%s: allows(%s) = %v, want %v", tt.name, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestNewSiteScopeInvalidPattern(t *testing.T) {
+	for _, record := range []URL{
+		{URL: "https://example.com/", IncludePattern: "(unclosed"},
+		{URL: "https://example.com/", ExcludePattern: "[a-"},
+	} {
+		if _, err := newSiteScope(&record); err == nil {
+			t.Errorf("%+v: expected an error for the invalid pattern", record)
+		}
+	}
+}
+
+func TestSiteLimits(t *testing.T) {
+	tests := []struct {
+		maxDepth, maxPages   int
+		env                  string
+		wantDepth, wantPages int
+	}{
+		{2, 10, "", 2, 10},
+		{0, 0, "", 0, defaultSiteMaxPages},
+		{-1, -5, "", 0, defaultSiteMaxPages},
+		{3, 1000, "", 3, 500},
+		{3, 1000, "20", 3, 20},
+		{3, 0, "20", 3, 20},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("SITE_MAX_PAGES", tt.env)
+		depth, pages := siteLimits(&URL{MaxDepth: tt.maxDepth, MaxPages: tt.maxPages})
+		if depth != tt.wantDepth || pages != tt.wantPages {
+			t.Errorf("siteLimits(%d, %d) with SITE_MAX_PAGES=%q = %d, %d, want %d, %d",
+				tt.maxDepth, tt.maxPages, tt.env, depth, pages, tt.wantDepth, tt.wantPages)
+		}
+	}
+}
+
+func TestPageKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"https://example.com/a", "https://example.com/a"},
+		{"https://example.com/a#section", "https://example.com/a"},
+		{"https://Example.COM/A", "https://example.com/A"},
+		{"https://example.com", "https://example.com/"},
+		{"https://example.com/a?b=1#c", "https://example.com/a?b=1"},
+	}
+
+	for _, tt := range tests {
+		if got := pageKey(tt.in); got != tt.want {
+			t.Errorf("pageKey(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// siteServer serves a small site. /away redirects to another host and
+// /moved to a page linked from the root as well.
+func siteServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><a href="/elsewhere">Elsewhere</a></body></html>`))
+	}))
+	t.Cleanup(other.Close)
+	// Same address, different host name
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+
+	pages := map[string]string{
+		"/": `<a href="/a">A</a> <a href="/a#top">A again</a> <a href="/b">B</a> <a href="/moved">Moved</a>
+			<a href="/away">Away</a> <a href="/renamed">Renamed</a> <a href="/private/x">Private</a>`,
+		"/a":         `<a href="/a/deep">Deep</a>`,
+		"/a/deep":    `<a href="/a/deeper">Deeper</a>`,
+		"/a/deeper":  `Too deep`,
+		"/b":         `B`,
+		"/c":         `C`,
+		"/private/x": `Private`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/b", http.StatusFound)
+			return
+		case "/renamed":
+			http.Redirect(w, r, "/c", http.StatusMovedPermanently)
+			return
+		case "/away":
+			http.Redirect(w, r, otherURL+"/", http.StatusFound)
+			return
+		}
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>" + r.URL.Path + "</title></head><body>" + body + "</body></html>"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func crawledPages(t *testing.T, server *httptest.Server, urlRecord *URL) []string {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: checkRedirect}
+	policy := &crawlPolicy{IgnoreRobots: true}
+	run := &CrawlRun{ID: urlRecord.ID}
+
+	rootDoc, _, err := fetchPage(context.Background(), client, urlRecord.URL, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawlSite(context.Background(), client, urlRecord, run, rootDoc, policy, nil, nil)
+
+	var pages []CrawledPage
+	db.Where("run_id = ?", run.ID).Find(&pages)
+	var paths []string
+	for _, page := range pages {
+		paths = append(paths, strings.TrimPrefix(page.PageURL, server.URL))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestCrawlSite(t *testing.T) {
+	openTestDB(t)
+	server := siteServer(t)
+
+	urlRecord := &URL{ID: 1, URL: server.URL + "/", CrawlMode: "site", Scope: "host", MaxDepth: 2, MaxPages: 50, ExcludePattern: "^/private"}
+	got := crawledPages(t, server, urlRecord)
+
+	// /a#top is /a, /moved ends at /b which was already crawled, /away leaves
+	// the host, /renamed is stored under the URL it redirected to, /private
+	// is excluded and /a/deeper is beyond the depth limit
+	want := []string{"/", "/a", "/a/deep", "/b", "/c"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+	if urlRecord.PagesCrawled != len(want) {
+		t.Errorf("PagesCrawled = %d, want %d", urlRecord.PagesCrawled, len(want))
+	}
+}
+
+func TestCrawlSiteLimits(t *testing.T) {
+	openTestDB(t)
+	server := siteServer(t)
+
+	// Depth 0 only keeps the root page
+	got := crawledPages(t, server, &URL{ID: 1, URL: server.URL + "/", CrawlMode: "site", MaxDepth: 0, MaxPages: 50})
+	if strings.Join(got, " ") != "/" {
+		t.Errorf("depth 0 crawled %v, want only the root", got)
+	}
+
+	// Pages are visited breadth first until the limit
+	got = crawledPages(t, server, &URL{ID: 2, URL: server.URL + "/", CrawlMode: "site", MaxDepth: 5, MaxPages: 3})
+	if strings.Join(got, " ") != "/ /a /b" {
+		t.Errorf("3 pages crawled %v, want / /a /b", got)
+	}
+}
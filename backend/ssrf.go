@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// SSRF protection - crawled URLs are user input, so the crawler refuses to
+// connect to loopback, private, link-local (including cloud metadata) and
+// other non-public addresses. CRAWL_ALLOWED_NETWORKS lists CIDRs, IPs or
+// hostnames of internal sites that may be crawled anyway.
+type blockedAddressError struct {
+	Host string
+	IP   net.IP
+}
+
+func (e *blockedAddressError) Error() string {
+	if e.Host == e.IP.String() {
+		return fmt.Sprintf("%s is not a public address", e.IP)
+	}
+	return fmt.Sprintf("%s resolves to %s, which is not a public address", e.Host, e.IP)
+}
+
+// Ranges not covered by the net.IP predicates used in publicIP
+var reservedNetworks = parseCIDRs(
+	"0.0.0.0/8",       // "this" network
+	"100.64.0.0/10",   // carrier-grade NAT
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // documentation
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"240.0.0.0/4",     // reserved, including broadcast
+	"64:ff9b::/96",    // NAT64, can reach embedded IPv4 addresses
+	"2001:db8::/32",   // documentation
+)
+
+type ssrfAllowlist struct {
+	networks []*net.IPNet
+	hosts    map[string]bool
+}
+
+var crawlAllowlist = loadSSRFAllowlist(os.Getenv("CRAWL_ALLOWED_NETWORKS"))
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func loadSSRFAllowlist(value string) *ssrfAllowlist {
+	allowlist := &ssrfAllowlist{hosts: make(map[string]bool)}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			allowlist.networks = append(allowlist.networks, network)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			allowlist.networks = append(allowlist.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		allowlist.hosts[entry] = true
+	}
+
+	if len(allowlist.networks) > 0 || len(allowlist.hosts) > 0 {
+		log.Printf("Crawler may reach internal addresses: %s", value)
+	}
+	return allowlist
+}
+
+// publicIP reports whether ip is a globally routable unicast address
+func publicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// permits reports whether the crawler may connect to ip when asked for host
+func (a *ssrfAllowlist) permits(host string, ip net.IP) bool {
+	if publicIP(ip) || a.hosts[strings.ToLower(strings.TrimSuffix(host, "."))] {
+		return true
+	}
+	for _, network := range a.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveAllowed resolves host and returns the addresses the crawler may
+// connect to. It fails if every address is blocked.
+func (a *ssrfAllowlist) resolveAllowed(ctx context.Context, host string) ([]net.IP, error) {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	var allowed []net.IP
+	var blocked error
+	for _, ip := range ips {
+		if a.permits(host, ip) {
+			allowed = append(allowed, ip)
+		} else if blocked == nil {
+			blocked = &blockedAddressError{Host: host, IP: ip}
+		}
+	}
+	if len(allowed) == 0 {
+		if blocked == nil {
+			blocked = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+		}
+		return nil, blocked
+	}
+	return allowed, nil
+}
+
+// safeDialContext resolves the host itself and connects to the checked
+// address, so a DNS answer can't change between the check and the connect
+func safeDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := crawlAllowlist.resolveAllowed(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// checkRedirect hands redirects back to the caller. doCrawlRequest follows
+// them itself so every hop goes through robots.txt and the host limiter; the
+// destination address of each hop is checked when its connection is dialled.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// crawlTransport is shared by every crawler client. Proxies are disabled
+// since a proxy would connect on our behalf without the address checks.
+var crawlTransport = &http.Transport{
+	Proxy:                 nil,
+	DialContext:           safeDialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// newCrawlClient returns an HTTP client for fetching user-submitted URLs
+func newCrawlClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     crawlTransport,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// blockedAddressMessage returns a readable error for crawls of blocked addresses
+func blockedAddressMessage(err error) (string, bool) {
+	var blockedErr *blockedAddressError
+	if errors.As(err, &blockedErr) {
+		return "Refusing to crawl: " + blockedErr.Error(), true
+	}
+	return "", false
+}
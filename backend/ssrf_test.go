@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		// Public
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+
+		// Loopback and unspecified
+		{"127.0.0.1", false},
+		{"127.255.255.254", false},
+		{"::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+
+		// RFC 1918
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"172.32.0.1", true},
+
+		// Link-local, including the cloud metadata endpoint
+		{"169.254.169.254", false},
+		{"169.254.0.1", false},
+		{"fe80::1", false},
+
+		// IPv6 unique local
+		{"fc00::1", false},
+		{"fd12:3456:789a::1", false},
+
+		// IPv4 addresses written as IPv6
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"::ffff:93.184.216.34", true},
+		{"64:ff9b::7f00:1", false},
+
+		// Other reserved ranges
+		{"100.64.0.1", false},
+		{"192.0.2.1", false},
+		{"198.18.0.1", false},
+		{"255.255.255.255", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"2001:db8::1", false},
+	}
+
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.ip)
+		if ip == nil {
+			t.Fatalf("invalid test address %q", tt.ip)
+		}
+		if got := publicIP(ip); got != tt.want {
+			t.Errorf("publicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestSSRFAllowlist(t *testing.T) {
+	allowlist := loadSSRFAllowlist(" 10.1.0.0/16, 192.168.1.5 ,Intranet.Example.com,fd00::/8")
+
+	tests := []struct {
+		name string
+		host string
+		ip   string
+		want bool
+	}{
+		{"public addresses need no entry", "example.com", "93.184.216.34", true},
+		{"inside allowed network", "app.internal", "10.1.2.3", true},
+		{"outside allowed network", "app.internal", "10.2.0.1", false},
+		{"allowed single address", "192.168.1.5", "192.168.1.5", true},
+		{"single address is not a network", "192.168.1.6", "192.168.1.6", false},
+		{"allowed host name", "intranet.example.com", "10.9.9.9", true},
+		{"host names match case-insensitively", "INTRANET.example.com.", "10.9.9.9", true},
+		{"other host names stay blocked", "other.example.com", "10.9.9.9", false},
+		{"allowed IPv6 network", "v6.internal", "fd00::1", true},
+		{"metadata endpoint stays blocked", "metadata", "169.254.169.254", false},
+		{"loopback stays blocked", "localhost", "127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowlist.permits(tt.host, net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("permits(%q, %s) = %v, want %v", tt.host, tt.ip, got, tt.want)
+			}
+		})
+	}
+
+	empty := loadSSRFAllowlist("")
+	if empty.permits("localhost", net.ParseIP("127.0.0.1")) {
+		t.Error("an empty allowlist permits loopback")
+	}
+}
+
+func TestResolveAllowedLiteral(t *testing.T) {
+	allowlist := loadSSRFAllowlist("")
+
+	_, err := allowlist.resolveAllowed(context.Background(), "169.254.169.254")
+	var blockedErr *blockedAddressError
+	if !errors.As(err, &blockedErr) {
+		t.Fatalf("resolveAllowed(169.254.169.254) error = %v, want a blockedAddressError", err)
+	}
+
+	ips, err := allowlist.resolveAllowed(context.Background(), "93.184.216.34")
+	if err != nil || len(ips) != 1 {
+		t.Errorf("resolveAllowed(93.184.216.34) = %v, %v", ips, err)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Structured data (schema.org) found in JSON-LD blocks, microdata and RDFa
+const (
+	maxStructuredItems = 100     // items kept per page
+	maxStructuredRaw   = 2 << 10 // bytes of an unparseable block kept for debugging
+)
+
+// StructuredData is one top-level item of a page. Items that can't be
+// parsed are kept with their raw text and an error.
+type StructuredData struct {
+	ID         uint        `json:"id" gorm:"primaryKey"`
+	PageMetaID uint        `json:"page_meta_id" gorm:"index"`
+	URLID      uint        `json:"url_id" gorm:"index"`
+	RunID      uint        `json:"run_id" gorm:"index"`
+	PageURL    string      `json:"page_url"`
+	Format     string      `json:"format"` // json-ld, microdata, rdfa
+	Type       string      `json:"type"`   // schema.org type without its vocabulary
+	Data       interface{} `json:"data" gorm:"type:mediumtext;serializer:json"`
+	Raw        string      `json:"raw,omitempty" gorm:"type:text"`
+	Errors     []string    `json:"errors" gorm:"type:text;serializer:json"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// requiredProperties lists the properties checked for common types. A
+// group of several names is satisfied by any one of them.
+var requiredProperties = map[string][][]string{
+	"Product":        {{"name"}, {"offers", "review", "aggregateRating"}},
+	"Article":        {{"headline"}, {"author"}, {"datePublished"}},
+	"NewsArticle":    {{"headline"}, {"author"}, {"datePublished"}},
+	"BlogPosting":    {{"headline"}, {"author"}, {"datePublished"}},
+	"BreadcrumbList": {{"itemListElement"}},
+	"Organization":   {{"name"}, {"url"}},
+}
+
+// collectStructuredData records JSON-LD blocks and top-level microdata and
+// RDFa items. Nested items are part of their parent's data.
+func collectStructuredData(n *html.Node, meta *PageMeta, baseURL string) {
+	if meta == nil || len(meta.StructuredData) >= maxStructuredItems {
+		return
+	}
+
+	switch {
+	case n.Data == "script" && strings.EqualFold(strings.TrimSpace(attrValue(n, "type")), "application/ld+json"):
+		meta.addJSONLD(textContent(n))
+	case hasAttr(n, "itemscope") && !hasAttr(n, "itemprop"):
+		item := extractItem(n, microdata, baseURL)
+		meta.addItem("microdata", item)
+	case hasAttr(n, "typeof") && !hasAttr(n, "property") && !hasRDFaParent(n):
+		item := extractItem(n, rdfa, baseURL)
+		meta.addItem("rdfa", item)
+	}
+}
+
+func (meta *PageMeta) addJSONLD(text string) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(text), &data); err != nil {
+		raw := truncateUTF8(strings.TrimSpace(text), maxStructuredRaw)
+		meta.StructuredData = append(meta.StructuredData, StructuredData{
+			URLID:   meta.URLID,
+			RunID:   meta.RunID,
+			PageURL: meta.PageURL,
+			Format:  "json-ld",
+			Raw:     raw,
+			Errors:  []string{"Invalid JSON: " + err.Error()},
+		})
+		return
+	}
+
+	// A block may hold a single item, an array of items or an @graph
+	var items []interface{}
+	switch value := data.(type) {
+	case []interface{}:
+		items = value
+	case map[string]interface{}:
+		if graph, ok := value["@graph"].([]interface{}); ok {
+			items = graph
+		} else {
+			items = []interface{}{value}
+		}
+	default:
+		items = []interface{}{value}
+	}
+
+	for _, item := range items {
+		meta.addItem("json-ld", item)
+	}
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character, so
+// the result still stores in a utf8mb4 column
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (meta *PageMeta) addItem(format string, data interface{}) {
+	if len(meta.StructuredData) >= maxStructuredItems {
+		return
+	}
+
+	record := StructuredData{
+		URLID:   meta.URLID,
+		RunID:   meta.RunID,
+		PageURL: meta.PageURL,
+		Format:  format,
+		Data:    data,
+		Errors:  []string{},
+	}
+	item, ok := data.(map[string]interface{})
+	if !ok {
+		record.Errors = append(record.Errors, "Item is not an object")
+	} else {
+		record.Type = itemType(item)
+		if record.Type == "" {
+			record.Errors = append(record.Errors, "Item has no type")
+		}
+		record.Errors = append(record.Errors, validateItem(record.Type, item)...)
+	}
+
+	meta.StructuredData = append(meta.StructuredData, record)
+}
+
+// validateItem reports the required properties an item is missing
+func validateItem(itemType string, item map[string]interface{}) []string {
+	var problems []string
+	for _, group := range requiredProperties[itemType] {
+		if !hasAnyProperty(item, group) {
+			problems = append(problems, "Missing required property: "+strings.Join(group, " or "))
+		}
+	}
+
+	// Every breadcrumb needs a position and a name or item
+	if itemType == "BreadcrumbList" {
+		for i, element := range propertyValues(item["itemListElement"]) {
+			crumb, ok := element.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if !hasAnyProperty(crumb, []string{"position"}) {
+				problems = append(problems, fmt.Sprintf("Breadcrumb %d is missing position", i+1))
+			}
+			if !hasAnyProperty(crumb, []string{"name", "item"}) {
+				problems = append(problems, fmt.Sprintf("Breadcrumb %d is missing name or item", i+1))
+			}
+		}
+	}
+
+	return problems
+}
+
+func hasAnyProperty(item map[string]interface{}, names []string) bool {
+	for _, name := range names {
+		for _, value := range propertyValues(item[name]) {
+			if s, ok := value.(string); !ok || strings.TrimSpace(s) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// propertyValues treats a single value and an array of values alike
+func propertyValues(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
+
+// itemType returns the first type of an item without its vocabulary, so
+// "https://schema.org/Product" and "schema:Product" are both "Product"
+func itemType(item map[string]interface{}) string {
+	for _, value := range propertyValues(item["@type"]) {
+		if s, ok := value.(string); ok && s != "" {
+			return shortTypeName(s)
+		}
+	}
+	return ""
+}
+
+func shortTypeName(name string) string {
+	name = strings.TrimRight(strings.TrimSpace(name), "/")
+	if i := strings.LastIndexAny(name, "/:#"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// itemSyntax describes how microdata and RDFa mark items and properties
+type itemSyntax struct {
+	isItem   func(*html.Node) bool
+	propAttr string
+	typeAttr string
+}
+
+var microdata = itemSyntax{
+	isItem:   func(n *html.Node) bool { return hasAttr(n, "itemscope") },
+	propAttr: "itemprop",
+	typeAttr: "itemtype",
+}
+
+var rdfa = itemSyntax{
+	isItem:   func(n *html.Node) bool { return hasAttr(n, "typeof") },
+	propAttr: "property",
+	typeAttr: "typeof",
+}
+
+// extractItem converts an item element and its properties to the shape
+// of a JSON-LD object
+func extractItem(n *html.Node, syntax itemSyntax, baseURL string) map[string]interface{} {
+	item := make(map[string]interface{})
+	if types := strings.Fields(attrValue(n, syntax.typeAttr)); len(types) > 0 {
+		item["@type"] = types[0]
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		collectItemProperties(c, syntax, item, baseURL)
+	}
+	return item
+}
+
+func collectItemProperties(n *html.Node, syntax itemSyntax, item map[string]interface{}, baseURL string) {
+	if n.Type != html.ElementNode {
+		return
+	}
+
+	names := strings.Fields(attrValue(n, syntax.propAttr))
+	if len(names) > 0 {
+		var value interface{}
+		if syntax.isItem(n) {
+			value = extractItem(n, syntax, baseURL)
+		} else {
+			value = propertyValue(n, baseURL)
+		}
+		for _, name := range names {
+			addProperty(item, shortTypeName(name), value)
+		}
+	}
+
+	// Properties inside a nested item belong to that item
+	if syntax.isItem(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		collectItemProperties(c, syntax, item, baseURL)
+	}
+}
+
+// addProperty turns a property into an array when it is given more than once
+func addProperty(item map[string]interface{}, name string, value interface{}) {
+	existing, ok := item[name]
+	if !ok {
+		item[name] = value
+		return
+	}
+	if values, ok := existing.([]interface{}); ok {
+		item[name] = append(values, value)
+		return
+	}
+	item[name] = []interface{}{existing, value}
+}
+
+// propertyValue reads a property the way the microdata spec does, which
+// also covers the basic RDFa attributes
+func propertyValue(n *html.Node, baseURL string) string {
+	if content, ok := getAttr(n, "content"); ok {
+		return strings.TrimSpace(content)
+	}
+
+	var attr string
+	switch n.Data {
+	case "a", "area", "link":
+		attr = "href"
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		attr = "src"
+	case "object":
+		attr = "data"
+	case "data", "meter":
+		attr = "value"
+	case "time":
+		attr = "datetime"
+	}
+	if hasAttr(n, "resource") {
+		attr = "resource"
+	}
+
+	if value, ok := getAttr(n, attr); ok && attr != "" {
+		if attr == "href" || attr == "src" || attr == "data" || attr == "resource" {
+			return resolveURL(strings.TrimSpace(value), baseURL)
+		}
+		return strings.TrimSpace(value)
+	}
+
+	return strings.Join(strings.Fields(textContent(n)), " ")
+}
+
+// hasRDFaParent reports whether an RDFa item is nested in another one
+func hasRDFaParent(n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && hasAttr(p, "typeof") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	_, ok := getAttr(n, key)
+	return ok
+}
+
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
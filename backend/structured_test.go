@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello", 3, "hel"},
+		{"héllo", 2, "h"},  // é is 2 bytes
+		{"héllo", 3, "hé"}, // cut right after é
+		{"a€b", 3, "a"},    // € is 3 bytes
+		{"a€b", 4, "a€"},   // cut right after €
+		{"😀😀", 5, "😀"},     // 4-byte runes
+		{"😀", 3, ""},       // no whole rune fits
+		{"", 0, ""},
+	}
+
+	for _, tt := range tests {
+		got := truncateUTF8(tt.s, tt.n)
+		if got != tt.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateUTF8(%q, %d) is not valid UTF-8", tt.s, tt.n)
+		}
+	}
+}
+
+func TestAddJSONLDInvalidKeepsValidUTF8(t *testing.T) {
+	// Put a 2-byte character across the truncation point
+	text := "{" + strings.Repeat("a", maxStructuredRaw-2) + "é and more"
+
+	meta := &PageMeta{}
+	meta.addJSONLD(text)
+
+	if len(meta.StructuredData) != 1 {
+		t.Fatalf("got %d items, want 1", len(meta.StructuredData))
+	}
+	item := meta.StructuredData[0]
+	if len(item.Errors) == 0 {
+		t.Error("invalid JSON-LD recorded without an error")
+	}
+	if len(item.Raw) > maxStructuredRaw {
+		t.Errorf("raw is %d bytes, want at most %d", len(item.Raw), maxStructuredRaw)
+	}
+	if !utf8.ValidString(item.Raw) {
+		t.Error("raw was cut inside a character")
+	}
+}
+
+func TestAnalyzePageSavesResults(t *testing.T) {
+	openTestDB(t)
+
+	doc, err := html.Parse(strings.NewReader(`<!DOCTYPE html><html lang="fr"><head><title>Café</title>
+<script type="application/ld+json">{"@context":"https://schema.org","@type":"Organization","name":"Café","url":"https://example.com/"}</script>
+</head><body><main><h1>Café</h1></main></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urlRecord := &URL{ID: 1, URL: "https://example.com/"}
+	run := &CrawlRun{ID: 2}
+	var analysis PageAnalysis
+	analyzePage(doc, &analysis, urlRecord, run, urlRecord.URL, nil)
+
+	var metaCount, dataCount, auditCount int64
+	db.Model(&PageMeta{}).Where("url_id = ? AND run_id = ?", 1, 2).Count(&metaCount)
+	db.Model(&StructuredData{}).Where("url_id = ? AND run_id = ?", 1, 2).Count(&dataCount)
+	db.Model(&AccessibilityAudit{}).Where("url_id = ? AND run_id = ?", 1, 2).Count(&auditCount)
+	if metaCount != 1 || dataCount != 1 || auditCount != 1 {
+		t.Errorf("saved %d page meta, %d structured data and %d audits, want 1 of each", metaCount, dataCount, auditCount)
+	}
+	if analysis.Title != "Café" || analysis.AccessibilityScore == 0 {
+		t.Errorf("analysis = %+v", analysis)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stream tickets let EventSource clients, which can't set headers, open
+// /api/events without putting an access token in the URL where request logs
+// and proxies would keep it. A ticket works once and expires quickly.
+const streamTicketTTL = 30 * time.Second
+
+type StreamTicket struct {
+	ID         uint      `gorm:"primaryKey"`
+	TicketHash string    `gorm:"size:64;uniqueIndex;not null"`
+	UserID     uint      `gorm:"index;not null"`
+	SessionID  uint      // session the ticket was issued to, 0 for API keys
+	APIKeyID   uint      // API key the ticket was issued to, 0 for sessions
+	ExpiresAt  time.Time `gorm:"index"`
+	CreatedAt  time.Time
+}
+
+type StreamTicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+var errInvalidStreamTicket = errors.New("invalid or expired stream ticket")
+
+// redeemStreamTicket looks up a ticket and deletes it so it can't be used again
+func redeemStreamTicket(ticket string) (*StreamTicket, error) {
+	var streamTicket StreamTicket
+	if err := db.Where("ticket_hash = ? AND expires_at > ?", hashToken(ticket), time.Now()).First(&streamTicket).Error; err != nil {
+		return nil, errInvalidStreamTicket
+	}
+
+	// Only one of two concurrent requests with the same ticket deletes it
+	result := db.Delete(&StreamTicket{}, streamTicket.ID)
+	if result.Error != nil || result.RowsAffected != 1 {
+		return nil, errInvalidStreamTicket
+	}
+	return &streamTicket, nil
+}
+
+// streamAuth authenticates /api/events with a ?ticket= from
+// createStreamTicket, or like the rest of the API when there is none
+func streamAuth() gin.HandlerFunc {
+	auth := authMiddleware()
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if ticket == "" {
+			auth(c)
+			return
+		}
+
+		if db == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+			return
+		}
+
+		streamTicket, err := redeemStreamTicket(ticket)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired stream ticket"})
+			return
+		}
+
+		// The session or key may have been revoked since the ticket was issued
+		var user User
+		if err := db.First(&user, streamTicket.UserID).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired stream ticket"})
+			return
+		}
+		if streamTicket.SessionID != 0 && !sessionActive(streamTicket.SessionID) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			return
+		}
+		if streamTicket.APIKeyID != 0 {
+			var apiKey APIKey
+			if err := db.Where("id = ? AND revoked_at IS NULL", streamTicket.APIKeyID).First(&apiKey).Error; err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+			c.Set("api_key_id", apiKey.ID)
+			c.Set("api_key_scopes", apiKey.Scopes)
+		}
+
+		c.Set("user_id", user.ID)
+		c.Set("username", user.Username)
+		c.Set("role", user.Role)
+		c.Set("session_id", streamTicket.SessionID)
+
+		c.Next()
+	}
+}
+
+// API Handlers
+func createStreamTicket(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stream ticket"})
+		return
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now()
+	streamTicket := StreamTicket{
+		TicketHash: hashToken(ticket),
+		UserID:     c.GetUint("user_id"),
+		SessionID:  c.GetUint("session_id"),
+		APIKeyID:   c.GetUint("api_key_id"),
+		ExpiresAt:  now.Add(streamTicketTTL),
+	}
+	if err := db.Create(&streamTicket).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stream ticket"})
+		return
+	}
+
+	// Tickets that were never used are cleaned up as new ones are issued
+	db.Where("expires_at < ?", now).Delete(&StreamTicket{})
+
+	c.JSON(http.StatusCreated, StreamTicketResponse{Ticket: ticket, ExpiresAt: streamTicket.ExpiresAt})
+}
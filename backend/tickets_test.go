@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamTicketRouter issues tickets as the given session or API key and
+// reports who a ticket authenticates as
+func streamTicketRouter(userID, sessionID, apiKeyID uint) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/ticket", func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("session_id", sessionID)
+		c.Set("api_key_id", apiKeyID)
+	}, createStreamTicket)
+	router.GET("/events", streamAuth(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"user_id":        c.GetUint("user_id"),
+			"role":           c.GetString("role"),
+			"api_key_scopes": c.GetString("api_key_scopes"),
+		})
+	})
+	return router
+}
+
+func issueStreamTicket(t *testing.T, router *gin.Engine) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ticket", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("issuing ticket: status %d: %s", w.Code, w.Body)
+	}
+	var resp StreamTicketResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Ticket
+}
+
+func openStream(router *gin.Engine, ticket string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events?ticket="+ticket, nil))
+	return w
+}
+
+func TestStreamTicketSingleUse(t *testing.T) {
+	openTestDB(t)
+	user := User{Username: "alice", PasswordHash: "x", Role: roleOperator}
+	db.Create(&user)
+	session := Session{UserID: user.ID, TokenHash: "session", ExpiresAt: time.Now().Add(time.Hour)}
+	db.Create(&session)
+
+	router := streamTicketRouter(user.ID, session.ID, 0)
+	ticket := issueStreamTicket(t, router)
+
+	var stored StreamTicket
+	db.First(&stored)
+	if stored.TicketHash == ticket || stored.TicketHash != hashToken(ticket) {
+		t.Error("ticket should only be stored hashed")
+	}
+
+	w := openStream(router, ticket)
+	if w.Code != http.StatusOK {
+		t.Fatalf("first use: status %d: %s", w.Code, w.Body)
+	}
+	var got struct {
+		UserID uint   `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if got.UserID != user.ID || got.Role != roleOperator {
+		t.Errorf("authenticated as %+v, want user %d with role %s", got, user.ID, roleOperator)
+	}
+
+	if w := openStream(router, ticket); w.Code != http.StatusUnauthorized {
+		t.Errorf("second use: status %d, want 401", w.Code)
+	}
+}
+
+func TestStreamTicketRejected(t *testing.T) {
+	openTestDB(t)
+	user := User{Username: "alice", PasswordHash: "x", Role: roleViewer}
+	db.Create(&user)
+	session := Session{UserID: user.ID, TokenHash: "session", ExpiresAt: time.Now().Add(time.Hour)}
+	db.Create(&session)
+	router := streamTicketRouter(user.ID, session.ID, 0)
+
+	if w := openStream(router, "made-up"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown ticket: status %d, want 401", w.Code)
+	}
+
+	expired := issueStreamTicket(t, router)
+	db.Model(&StreamTicket{}).Where("ticket_hash = ?", hashToken(expired)).Update("expires_at", time.Now().Add(-time.Second))
+	if w := openStream(router, expired); w.Code != http.StatusUnauthorized {
+		t.Errorf("expired ticket: status %d, want 401", w.Code)
+	}
+
+	revoked := issueStreamTicket(t, router)
+	db.Model(&session).Update("revoked_at", time.Now())
+	if w := openStream(router, revoked); w.Code != http.StatusUnauthorized {
+		t.Errorf("ticket of a revoked session: status %d, want 401", w.Code)
+	}
+
+	// Without a ticket the usual Authorization header is required
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events?access_token=anything", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("access_token query: status %d, want 401", w.Code)
+	}
+}
+
+func TestStreamTicketAPIKey(t *testing.T) {
+	openTestDB(t)
+	user := User{Username: "ci", PasswordHash: "x", Role: roleOperator}
+	db.Create(&user)
+	apiKey := APIKey{UserID: user.ID, Name: "ci", KeyHash: "key", Scopes: "read"}
+	db.Create(&apiKey)
+	router := streamTicketRouter(user.ID, 0, apiKey.ID)
+
+	w := openStream(router, issueStreamTicket(t, router))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var got struct {
+		Scopes string `json:"api_key_scopes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if got.Scopes != "read" {
+		t.Errorf("scopes = %q, want the key's scopes", got.Scopes)
+	}
+
+	ticket := issueStreamTicket(t, router)
+	db.Model(&apiKey).Update("revoked_at", time.Now())
+	if w := openStream(router, ticket); w.Code != http.StatusUnauthorized {
+		t.Errorf("ticket of a revoked key: status %d, want 401", w.Code)
+	}
+}
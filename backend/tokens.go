@@ -0,0 +1,316 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// JWT signing keys. Several keys can be active at once so a new key can be
+// rolled out while tokens signed with the old one are still valid; only
+// the active key signs new tokens.
+type signingKeys struct {
+	keys      map[string][]byte
+	activeKID string
+}
+
+// jwtKeys is loaded at startup by main
+var jwtKeys *signingKeys
+
+// Session is a server-side refresh token. Access tokens carry the session
+// ID so logging out also invalidates them.
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	TokenHash  string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // seconds until the access token expires
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+}
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+func accessTokenTTL() time.Duration {
+	return time.Duration(getEnvInt("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute
+}
+
+func refreshTokenTTL() time.Duration {
+	return time.Duration(getEnvInt("REFRESH_TOKEN_TTL_HOURS", 24*30)) * time.Hour
+}
+
+// loadSigningKeys reads "kid:secret" pairs from JWT_KEYS (comma separated)
+// and JWT_KEYS_FILE (one per line, e.g. a Docker secret). JWT_ACTIVE_KID
+// picks the signing key and defaults to the first one listed. A plain
+// JWT_SECRET is accepted as a single key. There is no built-in key: without
+// any configuration the server refuses to start.
+func loadSigningKeys() (*signingKeys, error) {
+	sk := &signingKeys{keys: make(map[string][]byte)}
+	var order []string
+
+	add := func(entry string) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			return
+		}
+		kid, secret, ok := strings.Cut(entry, ":")
+		kid, secret = strings.TrimSpace(kid), strings.TrimSpace(secret)
+		if !ok || kid == "" || secret == "" {
+			log.Printf("Ignoring malformed JWT key entry (expected kid:secret)")
+			return
+		}
+		if _, exists := sk.keys[kid]; !exists {
+			order = append(order, kid)
+		}
+		sk.keys[kid] = []byte(secret)
+	}
+
+	for _, entry := range strings.Split(os.Getenv("JWT_KEYS"), ",") {
+		add(entry)
+	}
+	if path := os.Getenv("JWT_KEYS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT_KEYS_FILE: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			add(line)
+		}
+	}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" && len(order) == 0 {
+		add("default:" + secret)
+	}
+
+	if len(order) == 0 {
+		return nil, errors.New("no JWT signing keys configured; set JWT_KEYS or JWT_KEYS_FILE to kid:secret entries")
+	}
+
+	sk.activeKID = order[0]
+	if kid := os.Getenv("JWT_ACTIVE_KID"); kid != "" {
+		if _, exists := sk.keys[kid]; exists {
+			sk.activeKID = kid
+		} else {
+			log.Printf("JWT_ACTIVE_KID %q is not a configured key; signing with %q", kid, sk.activeKID)
+		}
+	}
+
+	return sk, nil
+}
+
+// sign signs claims with the active key and records its kid in the header
+func (sk *signingKeys) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = sk.activeKID
+	return token.SignedString(sk.keys[sk.activeKID])
+}
+
+// keyFunc looks up the verification key named by the token's kid
+func (sk *signingKeys) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, exists := sk.keys[kid]
+	if !exists {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// parseAccessToken verifies an access token and returns its claims
+func parseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, jwtKeys.keyFunc, jwt.WithValidMethods([]string{"HS256"}))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// newRefreshToken returns a random refresh token and the hash stored for it
+func newRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+// hashToken is how refresh tokens and API keys are stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens starts a new session for the user and returns its tokens
+func issueTokens(user *User) (*TokenResponse, error) {
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := Session{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	return sessionTokens(user, &session, refreshToken)
+}
+
+// sessionTokens signs a new access token for a session
+func sessionTokens(user *User, session *Session, refreshToken string) (*TokenResponse, error) {
+	ttl := accessTokenTTL()
+	token, err := generateToken(user, session.ID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(ttl.Seconds()),
+		Username:     user.Username,
+		Role:         user.Role,
+	}, nil
+}
+
+// findSession returns the live session a refresh token belongs to
+func findSession(tx *gorm.DB, refreshToken string) (*Session, error) {
+	var session Session
+	if err := tx.Where("token_hash = ?", hashToken(refreshToken)).First(&session).Error; err != nil {
+		return nil, errInvalidRefreshToken
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, errInvalidRefreshToken
+	}
+	return &session, nil
+}
+
+// sessionActive reports whether a session has not been revoked or expired
+func sessionActive(sessionID uint) bool {
+	var session Session
+	if err := db.Select("id", "expires_at", "revoked_at").First(&session, sessionID).Error; err != nil {
+		return false
+	}
+	return session.RevokedAt == nil && time.Now().Before(session.ExpiresAt)
+}
+
+// revokeSessions revokes all live sessions of a user except keepID
+func revokeSessions(userID, keepID uint) error {
+	return db.Model(&Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Token endpoints
+func refreshToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	// Refresh tokens are single use: each refresh replaces the token stored
+	// for the session, so a leaked token stops working once it's been used
+	var user User
+	var session *Session
+	newToken, newHash, err := newRefreshToken()
+	if err == nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			session, err = findSession(tx, req.RefreshToken)
+			if err != nil {
+				return err
+			}
+			if err := tx.First(&user, session.UserID).Error; err != nil {
+				return errInvalidRefreshToken
+			}
+
+			now := time.Now()
+			result := tx.Model(session).
+				Where("token_hash = ?", session.TokenHash).
+				Updates(map[string]interface{}{"token_hash": newHash, "last_used_at": now})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errInvalidRefreshToken
+			}
+			return nil
+		})
+	}
+	if errors.Is(err, errInvalidRefreshToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	// The access token picks up the user's current role
+	tokens, err := sessionTokens(&user, session, newToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func logout(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	// Logging out with an unknown or already revoked token succeeds too
+	if session, err := findSession(db, req.RefreshToken); err == nil {
+		if err := db.Model(session).Update("revoked_at", time.Now()).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
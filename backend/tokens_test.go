@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadSigningKeysRequiresConfiguration(t *testing.T) {
+	t.Setenv("JWT_KEYS", "")
+	t.Setenv("JWT_KEYS_FILE", "")
+	t.Setenv("JWT_SECRET", "")
+
+	if _, err := loadSigningKeys(); err == nil {
+		t.Fatal("loadSigningKeys succeeded without any keys configured")
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	t.Setenv("JWT_KEYS_FILE", "")
+	t.Setenv("JWT_SECRET", "")
+	t.Cleanup(func() { jwtKeys = nil })
+
+	user := &User{ID: 1, Username: "alice", Role: roleViewer}
+
+	t.Setenv("JWT_KEYS", "old:first-secret")
+	t.Setenv("JWT_ACTIVE_KID", "")
+	keys, err := loadSigningKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtKeys = keys
+	oldToken, err := generateToken(user, 1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Roll out a new key while the old one still verifies
+	t.Setenv("JWT_KEYS", "old:first-secret,new:second-secret")
+	t.Setenv("JWT_ACTIVE_KID", "new")
+	if jwtKeys, err = loadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if jwtKeys.activeKID != "new" {
+		t.Fatalf("active kid = %q, want new", jwtKeys.activeKID)
+	}
+	if _, err := parseAccessToken(oldToken); err != nil {
+		t.Errorf("token signed with the old key was rejected during rotation: %v", err)
+	}
+	newToken, err := generateToken(user, 1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Retire the old key
+	t.Setenv("JWT_KEYS", "new:second-secret")
+	if jwtKeys, err = loadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseAccessToken(oldToken); err == nil {
+		t.Error("token signed with a removed key was accepted")
+	}
+	claims, err := parseAccessToken(newToken)
+	if err != nil {
+		t.Fatalf("token signed with the new key was rejected: %v", err)
+	}
+	if claims.Username != "alice" || claims.Role != roleViewer {
+		t.Errorf("claims = %+v", claims)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// User accounts
+type User struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Username     string    `json:"username" gorm:"size:191;uniqueIndex;not null"`
+	PasswordHash string    `json:"-" gorm:"not null"`
+	Role         string    `json:"role" gorm:"size:16;not null;default:'viewer'"` // viewer, operator, admin
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=64"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8,max=72"`
+}
+
+// dummyHash is compared against when a username doesn't exist so failed
+// logins take the same time either way
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// authenticateUser checks a username and password against the database
+func authenticateUser(username, password string) (*User, error) {
+	var user User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// bootstrapAdmin creates the first account from ADMIN_USERNAME and
+// ADMIN_PASSWORD when the users table is empty. Without ADMIN_PASSWORD a
+// random password is generated and logged once.
+func bootstrapAdmin() {
+	var count int64
+	if err := db.Model(&User{}).Count(&count).Error; err != nil || count > 0 {
+		return
+	}
+
+	username := os.Getenv("ADMIN_USERNAME")
+	if username == "" {
+		username = "admin"
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	generated := password == ""
+	if generated {
+		buf := make([]byte, 18)
+		if _, err := rand.Read(buf); err != nil {
+			log.Printf("Failed to generate admin password: %v", err)
+			return
+		}
+		password = base64.RawURLEncoding.EncodeToString(buf)
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		log.Printf("Failed to hash admin password: %v", err)
+		return
+	}
+
+	if err := db.Create(&User{Username: username, PasswordHash: hash, Role: roleAdmin}).Error; err != nil {
+		log.Printf("Failed to create admin user: %v", err)
+		return
+	}
+
+	if generated {
+		log.Printf("Created admin user %q with generated password: %s", username, password)
+	} else {
+		log.Printf("Created admin user %q", username)
+	}
+}
+
+// Account endpoints
+func register(c *gin.Context) {
+	if os.Getenv("ALLOW_REGISTRATION") == "false" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled"})
+		return
+	}
+
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	user := User{Username: req.Username, PasswordHash: hash, Role: defaultRole()}
+	if err := db.Create(&user).Error; err != nil {
+		var existing User
+		if db.Where("username = ?", req.Username).First(&existing).Error == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already taken"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+func changePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	hash, err := hashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	if err := db.Model(&user).Update("password_hash", hash).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	// Sign out every other session that may have used the old password
+	if err := revokeSessions(user.ID, c.GetUint("session_id")); err != nil {
+		log.Printf("Failed to revoke sessions of user %q: %v", user.Username, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated"})
+}
+
+// migrateURLOwnership moves databases created before URLs had owners to the
+// per-user unique index and hands unowned URLs to the first account.
+func migrateURLOwnership() {
+	// The old single-column unique index on url blocks the same URL from
+	// being tracked by different users
+	if db.Migrator().HasIndex(&URL{}, "url") {
+		if err := db.Migrator().DropIndex(&URL{}, "url"); err != nil {
+			log.Printf("Failed to drop legacy url index: %v", err)
+		}
+	}
+
+	var owner User
+	if err := db.Order("id").First(&owner).Error; err != nil {
+		return
+	}
+
+	result := db.Model(&URL{}).Where("user_id = ?", 0).Update("user_id", owner.ID)
+	if result.Error == nil && result.RowsAffected > 0 {
+		log.Printf("Assigned %d unowned URLs to user %q", result.RowsAffected, owner.Username)
+	}
+}
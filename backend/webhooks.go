@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Outbound webhooks. Subscriptions receive HMAC-signed JSON when a crawl of
+// a URL they can see finishes. Failed deliveries are retried in process
+// with exponential backoff; retries still pending when the server stops
+// are not resumed.
+const (
+	webhookCrawlCompleted = "crawl.completed"
+	webhookCrawlFailed    = "crawl.failed"
+	webhookLinksRegressed = "links.regressed"
+)
+
+var webhookEvents = []string{webhookCrawlCompleted, webhookCrawlFailed, webhookLinksRegressed}
+
+// webhookClient sends deliveries. Targets are user input, so it uses the
+// crawler's SSRF-safe transport; tests can swap it for a plain client.
+var webhookClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: crawlTransport,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// webhookRetryBase is the delay before the first retry; it doubles on each attempt
+var webhookRetryBase = time.Duration(getEnvInt("WEBHOOK_RETRY_BASE_SECONDS", 5)) * time.Second
+
+type Webhook struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"index;not null"`
+	URL       string    `json:"url" gorm:"size:2048;not null"`
+	Events    string    `json:"events"` // comma separated
+	Secret    string    `json:"-" gorm:"size:128;not null"`
+	Active    bool      `json:"active" gorm:"default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery records one event sent to a webhook and its attempts
+type WebhookDelivery struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	WebhookID   uint       `json:"webhook_id" gorm:"index;not null"`
+	Event       string     `json:"event"`
+	URLID       uint       `json:"url_id"`
+	RunID       uint       `json:"run_id"`
+	Status      string     `json:"status"` // pending, succeeded, failed
+	Attempts    int        `json:"attempts"`
+	StatusCode  int        `json:"status_code"`
+	Error       string     `json:"error"`
+	Payload     string     `json:"payload" gorm:"type:mediumtext"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at"`
+}
+
+type WebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=crawl.completed crawl.failed links.regressed"`
+	Secret string   `json:"secret" binding:"omitempty,min=16,max=128"`
+}
+
+// WebhookResponse shows the secret, only when the webhook is created
+type WebhookResponse struct {
+	Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookPayload is the JSON body of every delivery
+type WebhookPayload struct {
+	Event      string             `json:"event"`
+	DeliveryID uint               `json:"delivery_id"`
+	SentAt     time.Time          `json:"sent_at"`
+	URL        URL                `json:"url"`
+	Run        CrawlRun           `json:"run"`
+	Regression *WebhookRegression `json:"regression,omitempty"`
+}
+
+// WebhookRegression compares broken link counts with the previous successful run
+type WebhookRegression struct {
+	PreviousRunID             uint `json:"previous_run_id"`
+	PreviousInaccessibleLinks int  `json:"previous_inaccessible_links"`
+	InaccessibleLinks         int  `json:"inaccessible_links"`
+}
+
+// signWebhook returns the signature sent in X-Webhook-Signature. The
+// timestamp is signed too so receivers can reject replayed deliveries.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookEventsFor returns the events a finished run triggers
+func webhookEventsFor(urlRecord *URL, run *CrawlRun) ([]string, *WebhookRegression) {
+	switch run.Status {
+	case "done":
+	case "error", "blocked":
+		return []string{webhookCrawlFailed}, nil
+	default:
+		return nil, nil
+	}
+
+	triggered := []string{webhookCrawlCompleted}
+
+	var previous CrawlRun
+	err := db.Where("url_id = ? AND id < ? AND status = ?", urlRecord.ID, run.ID, "done").
+		Order("id desc").First(&previous).Error
+	if err == nil && run.InaccessibleLinks > previous.InaccessibleLinks {
+		triggered = append(triggered, webhookLinksRegressed)
+		return triggered, &WebhookRegression{
+			PreviousRunID:             previous.ID,
+			PreviousInaccessibleLinks: previous.InaccessibleLinks,
+			InaccessibleLinks:         run.InaccessibleLinks,
+		}
+	}
+
+	return triggered, nil
+}
+
+// dispatchWebhooks queues deliveries for a finished run to every active
+// webhook whose owner can see the URL
+func dispatchWebhooks(urlRecord *URL, run *CrawlRun) {
+	triggered, regression := webhookEventsFor(urlRecord, run)
+	if len(triggered) == 0 {
+		return
+	}
+
+	query := db.Where("active = ?", true)
+	if urlRecord.ProjectID != nil {
+		members := db.Model(&OrganizationMember{}).Select("organization_members.user_id").
+			Joins("JOIN projects ON projects.organization_id = organization_members.organization_id").
+			Where("projects.id = ?", *urlRecord.ProjectID)
+		query = query.Where("user_id = ? OR user_id IN (?)", urlRecord.UserID, members)
+	} else {
+		query = query.Where("user_id = ?", urlRecord.UserID)
+	}
+
+	var webhooks []Webhook
+	if err := query.Find(&webhooks).Error; err != nil {
+		log.Printf("Failed to load webhooks for URL %d: %v", urlRecord.ID, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		subscribed := strings.Split(webhook.Events, ",")
+		for _, event := range triggered {
+			if !containsString(subscribed, event) {
+				continue
+			}
+
+			payload := WebhookPayload{Event: event, URL: *urlRecord, Run: *run}
+			if event == webhookLinksRegressed {
+				payload.Regression = regression
+			}
+
+			delivery := WebhookDelivery{
+				WebhookID: webhook.ID,
+				Event:     event,
+				URLID:     urlRecord.ID,
+				RunID:     run.ID,
+				Status:    "pending",
+			}
+			if err := db.Create(&delivery).Error; err != nil {
+				log.Printf("Failed to record webhook delivery: %v", err)
+				continue
+			}
+
+			go deliverWebhook(webhook, delivery, payload)
+		}
+	}
+}
+
+// deliverWebhook sends a delivery, retrying with exponential backoff until
+// it succeeds or WEBHOOK_MAX_ATTEMPTS is reached
+func deliverWebhook(webhook Webhook, delivery WebhookDelivery, payload WebhookPayload) {
+	maxAttempts := getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5)
+	delay := webhookRetryBase
+
+	payload.DeliveryID = delivery.ID
+	payload.SentAt = time.Now().UTC()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		db.Model(&delivery).Updates(map[string]interface{}{"status": "failed", "error": err.Error()})
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		statusCode, err := sendWebhook(webhook, delivery, body)
+
+		updates := map[string]interface{}{
+			"attempts":    attempt,
+			"status_code": statusCode,
+			"error":       "",
+			"payload":     string(body),
+		}
+		if err == nil {
+			now := time.Now()
+			updates["status"] = "succeeded"
+			updates["delivered_at"] = &now
+			db.Model(&delivery).Updates(updates)
+			return
+		}
+
+		updates["error"] = err.Error()
+		if attempt >= maxAttempts {
+			updates["status"] = "failed"
+			db.Model(&delivery).Updates(updates)
+			log.Printf("Webhook delivery %d to %s failed after %d attempts: %v", delivery.ID, webhook.URL, attempt, err)
+			return
+		}
+		db.Model(&delivery).Updates(updates)
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// sendWebhook makes one delivery attempt. Any 2xx response counts as delivered.
+func sendWebhook(webhook Webhook, delivery WebhookDelivery, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", crawlerUserAgent)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", signWebhook(webhook.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// API Handlers
+func loadOwnedWebhook(c *gin.Context) (*Webhook, bool) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return nil, false
+	}
+
+	var webhook Webhook
+	if err := db.Where("id = ? AND user_id = ?", id, c.GetUint("user_id")).First(&webhook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return nil, false
+	}
+
+	return &webhook, true
+}
+
+func createWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URL must be an http or https URL"})
+		return
+	}
+
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		buf := make([]byte, 24)
+		if _, err := rand.Read(buf); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+			return
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	webhook := Webhook{
+		UserID: c.GetUint("user_id"),
+		URL:    req.URL,
+		Events: strings.Join(req.Events, ","),
+		Secret: secret,
+		Active: true,
+	}
+	if err := db.Create(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, WebhookResponse{Webhook: webhook, Secret: secret})
+}
+
+func getWebhooks(c *gin.Context) {
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+		return
+	}
+
+	var webhooks []Webhook
+	if err := db.Where("user_id = ?", c.GetUint("user_id")).Order("id").Find(&webhooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+func deleteWebhook(c *gin.Context) {
+	webhook, ok := loadOwnedWebhook(c)
+	if !ok {
+		return
+	}
+
+	if err := db.Delete(webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	db.Where("webhook_id = ?", webhook.ID).Delete(&WebhookDelivery{})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Webhook deleted",
+		"webhook_id": webhook.ID,
+	})
+}
+
+func getWebhookDeliveries(c *gin.Context) {
+	webhook, ok := loadOwnedWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req PaginationRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 20
+	}
+
+	query := db.Model(&WebhookDelivery{}).Where("webhook_id = ?", webhook.ID)
+	if req.Filter != "" && req.Filter != "all" {
+		query = query.Where("status = ?", req.Filter)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var deliveries []WebhookDelivery
+	offset := (req.Page - 1) * req.PageSize
+	if err := query.Order("id desc").Limit(req.PageSize).Offset(offset).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       deliveries,
+		Total:      total,
+		Page:       req.Page,
+		PageSize:   req.PageSize,
+		TotalPages: int((total + int64(req.PageSize) - 1) / int64(req.PageSize)),
+	})
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the requests a test webhook endpoint receives and
+// answers each with the next of its status codes, then 200
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+	at     time.Time
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, receivedWebhook{header: req.Header.Clone(), body: body, at: time.Now()})
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *webhookReceiver) received() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.requests...)
+}
+
+// startWebhookReceiver serves a receiver and points webhookClient at it
+func startWebhookReceiver(t *testing.T, statuses ...int) (*webhookReceiver, *httptest.Server) {
+	t.Helper()
+	receiver := &webhookReceiver{statuses: statuses}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	client, retryBase := webhookClient, webhookRetryBase
+	webhookClient = server.Client()
+	webhookRetryBase = 20 * time.Millisecond
+	t.Cleanup(func() { webhookClient, webhookRetryBase = client, retryBase })
+
+	return receiver, server
+}
+
+func createTestDelivery(t *testing.T, webhook *Webhook, event string) WebhookDelivery {
+	t.Helper()
+	delivery := WebhookDelivery{WebhookID: webhook.ID, Event: event, URLID: 1, RunID: 2, Status: "pending"}
+	if err := db.Create(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+func TestDeliverWebhookSigned(t *testing.T) {
+	openTestDB(t)
+	receiver, server := startWebhookReceiver(t)
+
+	webhook := Webhook{UserID: 1, URL: server.URL + "/hook", Events: webhookCrawlCompleted, Secret: "0123456789abcdef", Active: true}
+	db.Create(&webhook)
+	delivery := createTestDelivery(t, &webhook, webhookCrawlCompleted)
+
+	deliverWebhook(webhook, delivery, WebhookPayload{
+		Event: webhookCrawlCompleted,
+		URL:   URL{ID: 1, URL: "https://example.com/"},
+		Run:   CrawlRun{ID: 2, Status: "done"},
+	})
+
+	requests := receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("received %d requests, want 1", len(requests))
+	}
+	req := requests[0]
+
+	// Receivers verify HMAC-SHA256 over "<timestamp>.<body>"
+	timestamp := req.header.Get("X-Webhook-Timestamp")
+	if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+		t.Errorf("X-Webhook-Timestamp = %q, want a Unix time", timestamp)
+	}
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(timestamp + "." + string(req.body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.header.Get("X-Webhook-Signature"); got != want {
+		t.Errorf("X-Webhook-Signature = %q, want %q", got, want)
+	}
+	if signWebhook("another secret", timestamp, req.body) == want {
+		t.Error("signature doesn't depend on the secret")
+	}
+
+	if got := req.header.Get("X-Webhook-Event"); got != webhookCrawlCompleted {
+		t.Errorf("X-Webhook-Event = %q", got)
+	}
+	if got := req.header.Get("X-Webhook-Delivery"); got != strconv.Itoa(int(delivery.ID)) {
+		t.Errorf("X-Webhook-Delivery = %q, want %d", got, delivery.ID)
+	}
+	if got := req.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.DeliveryID != delivery.ID || payload.URL.URL != "https://example.com/" || payload.Run.ID != 2 {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	var stored WebhookDelivery
+	db.First(&stored, delivery.ID)
+	if stored.Status != "succeeded" || stored.Attempts != 1 || stored.StatusCode != http.StatusOK || stored.Error != "" {
+		t.Errorf("delivery = %+v, want succeeded after 1 attempt", stored)
+	}
+	if stored.DeliveredAt == nil {
+		t.Error("delivered_at not set")
+	}
+	if stored.Payload != string(req.body) {
+		t.Error("stored payload differs from the body sent")
+	}
+}
+
+func TestDeliverWebhookRetries(t *testing.T) {
+	openTestDB(t)
+	receiver, server := startWebhookReceiver(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+
+	webhook := Webhook{UserID: 1, URL: server.URL, Events: webhookCrawlFailed, Secret: "0123456789abcdef", Active: true}
+	db.Create(&webhook)
+	delivery := createTestDelivery(t, &webhook, webhookCrawlFailed)
+
+	deliverWebhook(webhook, delivery, WebhookPayload{Event: webhookCrawlFailed})
+
+	requests := receiver.received()
+	if len(requests) != 3 {
+		t.Fatalf("received %d requests, want 3", len(requests))
+	}
+	// The delay doubles after each failed attempt
+	if gap := requests[1].at.Sub(requests[0].at); gap < webhookRetryBase {
+		t.Errorf("first retry after %v, want at least %v", gap, webhookRetryBase)
+	}
+	if gap := requests[2].at.Sub(requests[1].at); gap < 2*webhookRetryBase {
+		t.Errorf("second retry after %v, want at least %v", gap, 2*webhookRetryBase)
+	}
+	// Every attempt carries the same delivery
+	for _, req := range requests[1:] {
+		if req.header.Get("X-Webhook-Delivery") != requests[0].header.Get("X-Webhook-Delivery") {
+			t.Error("retry sent with a different delivery ID")
+		}
+	}
+
+	var stored WebhookDelivery
+	db.First(&stored, delivery.ID)
+	if stored.Status != "succeeded" || stored.Attempts != 3 || stored.StatusCode != http.StatusOK || stored.Error != "" {
+		t.Errorf("delivery = %+v, want succeeded after 3 attempts", stored)
+	}
+}
+
+func TestDeliverWebhookGivesUp(t *testing.T) {
+	openTestDB(t)
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+	receiver, server := startWebhookReceiver(t, 500, 500, 500, 500)
+
+	webhook := Webhook{UserID: 1, URL: server.URL, Events: webhookCrawlFailed, Secret: "0123456789abcdef", Active: true}
+	db.Create(&webhook)
+	delivery := createTestDelivery(t, &webhook, webhookCrawlFailed)
+
+	deliverWebhook(webhook, delivery, WebhookPayload{Event: webhookCrawlFailed})
+
+	if n := len(receiver.received()); n != 3 {
+		t.Errorf("received %d requests, want WEBHOOK_MAX_ATTEMPTS = 3", n)
+	}
+
+	var stored WebhookDelivery
+	db.First(&stored, delivery.ID)
+	if stored.Status != "failed" || stored.Attempts != 3 || stored.StatusCode != 500 || stored.Error != "HTTP 500" {
+		t.Errorf("delivery = %+v, want failed after 3 attempts with HTTP 500", stored)
+	}
+	if stored.DeliveredAt != nil {
+		t.Error("delivered_at set for a failed delivery")
+	}
+}
+
+func TestDispatchWebhooks(t *testing.T) {
+	openTestDB(t)
+	receiver, server := startWebhookReceiver(t)
+
+	urlRecord := URL{UserID: 1, URL: "https://example.com/", Status: "done"}
+	db.Create(&urlRecord)
+	previous := CrawlRun{URLID: urlRecord.ID, Status: "done", PageAnalysis: PageAnalysis{InaccessibleLinks: 1}}
+	db.Create(&previous)
+	run := CrawlRun{URLID: urlRecord.ID, Status: "done", PageAnalysis: PageAnalysis{InaccessibleLinks: 4}}
+	db.Create(&run)
+
+	subscribed := Webhook{UserID: 1, URL: server.URL, Events: "crawl.completed,links.regressed", Secret: "0123456789abcdef", Active: true}
+	failedOnly := Webhook{UserID: 1, URL: server.URL, Events: "crawl.failed", Secret: "0123456789abcdef", Active: true}
+	otherUser := Webhook{UserID: 2, URL: server.URL, Events: "crawl.completed", Secret: "0123456789abcdef", Active: true}
+	inactive := Webhook{UserID: 1, URL: server.URL, Events: "crawl.completed", Secret: "0123456789abcdef", Active: true}
+	for _, webhook := range []*Webhook{&subscribed, &failedOnly, &otherUser, &inactive} {
+		db.Create(webhook)
+	}
+	db.Model(&inactive).Update("active", false)
+
+	dispatchWebhooks(&urlRecord, &run)
+
+	// Deliveries are sent in the background
+	var deliveries []WebhookDelivery
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var pending int64
+		db.Model(&WebhookDelivery{}).Where("status = ?", "pending").Count(&pending)
+		if pending == 0 {
+			break
+		}
+	}
+	db.Order("id").Find(&deliveries)
+
+	if len(deliveries) != 2 {
+		t.Fatalf("got %d deliveries, want 2: %+v", len(deliveries), deliveries)
+	}
+	for i, event := range []string{webhookCrawlCompleted, webhookLinksRegressed} {
+		d := deliveries[i]
+		if d.WebhookID != subscribed.ID || d.Event != event || d.URLID != urlRecord.ID || d.RunID != run.ID || d.Status != "succeeded" {
+			t.Errorf("delivery %d = %+v, want a succeeded %s delivery", i, d, event)
+		}
+	}
+	if n := len(receiver.received()); n != 2 {
+		t.Errorf("received %d requests, want 2", n)
+	}
+
+	var payload WebhookPayload
+	json.Unmarshal([]byte(deliveries[1].Payload), &payload)
+	if payload.Regression == nil || payload.Regression.PreviousRunID != previous.ID ||
+		payload.Regression.PreviousInaccessibleLinks != 1 || payload.Regression.InaccessibleLinks != 4 {
+		t.Errorf("regression = %+v", payload.Regression)
+	}
+}
@@ -54,7 +54,14 @@ interface CrawlResult {
   id: number;
   url: string;
   title: string;
-  status: "queued" | "running" | "completed" | "error";
+  status:
+    | "pending"
+    | "queued"
+    | "running"
+    | "completed"
+    | "error"
+    | "stopped"
+    | "blocked";
   htmlVersion: string;
   internalLinks: number;
   externalLinks: number;
@@ -96,8 +103,8 @@ const transformBackendData = (data: URLResponse): CrawlResult => ({
 
 // Login Component
 const LoginForm = ({ onLogin }: { onLogin: () => void }) => {
-  const [username, setUsername] = useState("admin");
-  const [password, setPassword] = useState("password");
+  const [username, setUsername] = useState("");
+  const [password, setPassword] = useState("");
   const [isLoading, setIsLoading] = useState(false);
   const [error, setError] = useState("");
 
@@ -125,7 +132,7 @@ const LoginForm = ({ onLogin }: { onLogin: () => void }) => {
           </div>
           <CardTitle className="text-2xl">Web Crawler Assignment</CardTitle>
           <CardDescription>
-            Demo authentication for technical assessment project
+            Sign in with your account
           </CardDescription>
         </CardHeader>
         <CardContent>
@@ -162,15 +169,6 @@ const LoginForm = ({ onLogin }: { onLogin: () => void }) => {
               )}
             </Button>
           </form>
-          <div className="mt-4 text-sm text-gray-600 text-center">
-            <p>Demo credentials:</p>
-            <p>
-              <strong>Username:</strong> admin
-            </p>
-            <p>
-              <strong>Password:</strong> password
-            </p>
-          </div>
         </CardContent>
       </Card>
     </div>
@@ -246,11 +244,9 @@ function App() {
       setTotalPages(response.total_pages);
     } catch (error) {
       console.error("Failed to fetch URLs:", error);
-      // Don't show error for auth issues - handled in handleResponse
-      if (
-        !(error instanceof Error && error.message.includes("Authentication"))
-      ) {
-        // Could add a toast notification here
+      // The session could not be refreshed - back to the login form
+      if (error instanceof Error && error.message.includes("Authentication")) {
+        setIsAuthenticated(false);
       }
     }
   };
@@ -260,7 +256,7 @@ function App() {
   };
 
   const handleLogout = () => {
-    ApiService.clearToken();
+    ApiService.logout();
     setIsAuthenticated(false);
     setCrawlResults([]);
     setSelectedResult(null);
@@ -380,6 +376,7 @@ function App() {
 
   const getStatusBadge = (status: CrawlResult["status"]) => {
     const statusConfig = {
+      pending: { label: "Pending", className: "bg-gray-100 text-gray-800" },
       queued: { label: "Queued", className: "bg-yellow-100 text-yellow-800" },
       running: { label: "Running", className: "bg-blue-100 text-blue-800" },
       completed: {
@@ -387,6 +384,11 @@ function App() {
         className: "bg-green-100 text-green-800",
       },
       error: { label: "Error", className: "bg-red-100 text-red-800" },
+      stopped: { label: "Stopped", className: "bg-gray-100 text-gray-800" },
+      blocked: {
+        label: "Blocked by robots.txt",
+        className: "bg-orange-100 text-orange-800",
+      },
     };
 
     const config = statusConfig[status];
@@ -993,10 +995,13 @@ function App() {
                   className="px-3 py-2 border border-gray-300 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500 w-40"
                 >
                   <option value="all">All Status</option>
+                  <option value="pending">Pending</option>
                   <option value="queued">Queued</option>
                   <option value="running">Running</option>
                   <option value="done">Completed</option>
                   <option value="error">Error</option>
+                  <option value="stopped">Stopped</option>
+                  <option value="blocked">Blocked</option>
                 </select>
               </div>
             </div>
@@ -1113,7 +1118,9 @@ function App() {
                       <td className="p-3">{getStatusBadge(result.status)}</td>
                       <td className="p-3">
                         <div className="flex items-center gap-2">
-                          {result.status === "queued" && (
+                          {["pending", "stopped", "error", "blocked"].includes(
+                            result.status
+                          ) && (
                             <Button
                               size="sm"
                               variant="outline"
@@ -1122,7 +1129,8 @@ function App() {
                               <Play className="h-4 w-4" />
                             </Button>
                           )}
-                          {result.status === "running" && (
+                          {(result.status === "queued" ||
+                            result.status === "running") && (
                             <Button
                               size="sm"
                               variant="outline"
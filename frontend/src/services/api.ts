@@ -8,7 +8,10 @@ export interface LoginRequest {
 
 export interface LoginResponse {
   token: string;
+  refresh_token: string;
+  expires_in: number;
   username: string;
+  role: string;
 }
 
 export interface URLRequest {
@@ -20,7 +23,14 @@ export interface URLResponse {
   url: string;
   title: string;
   html_version: string;
-  status: "queued" | "running" | "done" | "error";
+  status:
+    | "pending"
+    | "queued"
+    | "running"
+    | "done"
+    | "error"
+    | "stopped"
+    | "blocked";
   created_at: string;
   updated_at: string;
   h1_count: number;
@@ -63,19 +73,28 @@ export interface BulkActionRequest {
 
 class ApiService {
   private token: string | null = null;
+  private refreshToken: string | null = null;
+  private refreshing: Promise<boolean> | null = null;
 
   constructor() {
     this.token = localStorage.getItem("auth_token");
+    this.refreshToken = localStorage.getItem("refresh_token");
   }
 
-  setToken(token: string) {
+  setToken(token: string, refreshToken?: string) {
     this.token = token;
     localStorage.setItem("auth_token", token);
+    if (refreshToken) {
+      this.refreshToken = refreshToken;
+      localStorage.setItem("refresh_token", refreshToken);
+    }
   }
 
   clearToken() {
     this.token = null;
+    this.refreshToken = null;
     localStorage.removeItem("auth_token");
+    localStorage.removeItem("refresh_token");
   }
 
   getToken(): string | null {
@@ -108,6 +127,50 @@ class ApiService {
     return response.json();
   }
 
+  // Access tokens are short-lived: on a 401 the session is refreshed once
+  // and the request retried with the new token
+  private async request<T>(path: string, init: RequestInit = {}): Promise<T> {
+    const send = () =>
+      fetch(`${API_BASE_URL}${path}`, { ...init, headers: this.getHeaders() });
+
+    let response = await send();
+    if (response.status === 401 && (await this.refreshSession())) {
+      response = await send();
+    }
+
+    return this.handleResponse<T>(response);
+  }
+
+  // Concurrent requests share a single refresh, since each refresh token
+  // can only be used once
+  private refreshSession(): Promise<boolean> {
+    if (!this.refreshToken) {
+      return Promise.resolve(false);
+    }
+
+    if (!this.refreshing) {
+      this.refreshing = fetch(`${API_BASE_URL}/token/refresh`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ refresh_token: this.refreshToken }),
+      })
+        .then(async (response) => {
+          if (!response.ok) {
+            return false;
+          }
+          const data: LoginResponse = await response.json();
+          this.setToken(data.token, data.refresh_token);
+          return true;
+        })
+        .catch(() => false)
+        .finally(() => {
+          this.refreshing = null;
+        });
+    }
+
+    return this.refreshing;
+  }
+
   // Authentication
   async login(username: string, password: string): Promise<LoginResponse> {
     const response = await fetch(`${API_BASE_URL}/login`, {
@@ -118,20 +181,32 @@ class ApiService {
 
     const data = await this.handleResponse<LoginResponse>(response);
     if (data.token) {
-      this.setToken(data.token);
+      this.setToken(data.token, data.refresh_token);
     }
     return data;
   }
 
+  // Ends the session on the server too, so the refresh token stops working
+  async logout(): Promise<void> {
+    const refreshToken = this.refreshToken;
+    this.clearToken();
+    if (!refreshToken) {
+      return;
+    }
+
+    await fetch(`${API_BASE_URL}/logout`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ refresh_token: refreshToken }),
+    }).catch((error) => console.error("Failed to log out:", error));
+  }
+
   // URLs Management
   async addUrl(url: string): Promise<URLResponse> {
-    const response = await fetch(`${API_BASE_URL}/api/urls`, {
+    return this.request<URLResponse>("/api/urls", {
       method: "POST",
-      headers: this.getHeaders(),
       body: JSON.stringify({ url }),
     });
-
-    return this.handleResponse<URLResponse>(response);
   }
 
   async getUrls(
@@ -155,55 +230,38 @@ class ApiService {
     if (params.filter && params.filter !== "all")
       queryParams.append("filter", params.filter);
 
-    const url = `${API_BASE_URL}/api/urls${
+    const path = `/api/urls${
       queryParams.toString() ? "?" + queryParams.toString() : ""
     }`;
-    console.log("Fetching URLs from:", url);
+    console.log("Fetching URLs from:", API_BASE_URL + path);
 
-    const response = await fetch(url, {
-      headers: this.getHeaders(),
-    });
-
-    return this.handleResponse<URLsResponse>(response);
+    return this.request<URLsResponse>(path);
   }
 
   async getUrlDetails(id: number): Promise<URLDetailResponse> {
-    const response = await fetch(`${API_BASE_URL}/api/urls/${id}`, {
-      headers: this.getHeaders(),
-    });
-
-    return this.handleResponse<URLDetailResponse>(response);
+    return this.request<URLDetailResponse>(`/api/urls/${id}`);
   }
 
   async startCrawling(id: number): Promise<{ message: string }> {
-    const response = await fetch(`${API_BASE_URL}/api/urls/${id}/start`, {
+    return this.request<{ message: string }>(`/api/urls/${id}/start`, {
       method: "POST",
-      headers: this.getHeaders(),
     });
-
-    return this.handleResponse<{ message: string }>(response);
   }
 
   async stopCrawling(id: number): Promise<{ message: string }> {
-    const response = await fetch(`${API_BASE_URL}/api/urls/${id}/stop`, {
+    return this.request<{ message: string }>(`/api/urls/${id}/stop`, {
       method: "POST",
-      headers: this.getHeaders(),
     });
-
-    return this.handleResponse<{ message: string }>(response);
   }
 
   async bulkAction(
     urlIds: number[],
     action: "delete" | "rerun"
   ): Promise<{ message: string }> {
-    const response = await fetch(`${API_BASE_URL}/api/urls/bulk`, {
+    return this.request<{ message: string }>("/api/urls/bulk", {
       method: "POST",
-      headers: this.getHeaders(),
       body: JSON.stringify({ url_ids: urlIds, action }),
     });
-
-    return this.handleResponse<{ message: string }>(response);
   }
 
   // Health check